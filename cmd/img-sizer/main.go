@@ -9,8 +9,10 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/spossner/img-sizer/internal/cache"
 	"github.com/spossner/img-sizer/internal/config"
 	"github.com/spossner/img-sizer/internal/handlers"
+	"github.com/spossner/img-sizer/internal/processing"
 	"github.com/spossner/img-sizer/internal/storage"
 	"github.com/spossner/img-sizer/internal/utils"
 
@@ -45,13 +47,40 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Initialize S3 client
-	s3Client, err := storage.NewS3Client(context.Background())
+	// Initialize storage backends of the allowed sources
+	backends, err := storage.NewBackends(context.Background(), cfg.S3, cfg.AllowedSources)
 	if err != nil {
-		logger.Error("failed to initialize S3 client", "error", err)
+		logger.Error("failed to initialize storage backends", "error", err)
 		os.Exit(1)
 	}
 
+	// Initialize HTTP fetcher for unmapped source URLs
+	httpFetcher := storage.NewHTTPFetcher(cfg.HTTPSource, cfg.IsAllowedHost)
+
+	// Initialize cache for rendered images
+	outputCache, err := cache.New(cfg.Cache)
+	if err != nil {
+		logger.Error("failed to initialize cache", "error", err)
+		os.Exit(1)
+	}
+
+	// Share rendered images between instances through the result bucket
+	var resultCache *cache.Bucket
+	if cfg.ResultBucket != "" {
+		resultStore, err := storage.NewS3Client(context.Background(), cfg.S3, storage.S3Options{})
+		if err != nil {
+			logger.Error("failed to initialize result bucket client", "error", err)
+			os.Exit(1)
+		}
+		resultCache = cache.NewBucket(resultStore, cfg.ResultBucket, logger)
+		outputCache = cache.Tiered{outputCache, resultCache}
+	}
+
+	// Bound the number of images processed concurrently
+	pool := processing.NewPool(cfg.Processing.Concurrency, cfg.Processing.QueueDepth, cfg.Processing.QueueTimeout)
+	// Admit decoding images according to their estimated memory
+	budget := processing.NewMemoryBudget(cfg.Processing.MemoryBudget, cfg.Processing.QueueTimeout)
+
 	// Create Fiber app with optimized config
 	app := fiber.New(fiber.Config{
 		AppName:                 "Image Sizer v2.0",
@@ -83,13 +112,16 @@ func main() {
 
 	// Add health routes
 	app.Get("/ping", handlers.GetPingHandler())
-	app.Get("/healthz", handlers.GetHealthHandler(cfg, s3Client))
-	app.Get("/readyz", handlers.GetReadinessHandler(cfg, s3Client))
+	app.Get("/healthz", handlers.GetHealthHandler(cfg, backends))
+	app.Get("/readyz", handlers.GetReadinessHandler(cfg, backends))
+	app.Get("/metrics", handlers.GetMetricsHandler(pool, budget))
 
 	// Add sizer routes
-	app.Get("/v2/resize.jpg", handlers.GetCombinedHandler(cfg, s3Client))
-	app.Get("/resize.jpg", handlers.GetResizeHandler(cfg, s3Client))
-	app.Get("/crop.jpg", handlers.GetCropHandler(cfg, s3Client))
+	app.Get("/v2/resize.jpg", handlers.GetCombinedHandler(cfg, backends, httpFetcher, outputCache, pool, budget))
+	app.Get("/v2/resize.webp", handlers.GetWebpHandler(cfg, backends, httpFetcher, outputCache, pool, budget))
+	app.Get("/v2/resize.png", handlers.GetPngHandler(cfg, backends, httpFetcher, outputCache, pool, budget))
+	app.Get("/resize.jpg", handlers.GetResizeHandler(cfg, backends, httpFetcher, outputCache, pool, budget))
+	app.Get("/crop.jpg", handlers.GetCropHandler(cfg, backends, httpFetcher, outputCache, pool, budget))
 
 	// Create channel to listen for errors coming from the server
 	serverErrors := make(chan error, 1)
@@ -125,6 +157,11 @@ func main() {
 			os.Exit(1)
 		}
 
+		// Finish uploads of rendered images
+		if resultCache != nil {
+			resultCache.Wait()
+		}
+
 		logger.Info("server stopped")
 	}
 }
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/spossner/img-sizer/internal/storage"
+)
+
+const (
+	// metadataETag is the object metadata holding the ETag of the rendered image
+	metadataETag = "etag"
+	// metadataLastModified is the object metadata holding the modification time of the source image
+	metadataLastModified = "source-last-modified"
+	// bucketWriteTimeout limits writing a rendered image to the result bucket
+	bucketWriteTimeout = 30 * time.Second
+)
+
+// BucketStore is the storage of the result bucket
+type BucketStore interface {
+	GetObject(ctx context.Context, bucket, key string) (*storage.Object, error)
+	HeadObject(ctx context.Context, bucket, key string) (*storage.ObjectInfo, error)
+	storage.Writer
+}
+
+// Bucket is a cache of rendered images in a storage bucket shared by all instances of the service
+type Bucket struct {
+	store  BucketStore
+	bucket string
+	logger *slog.Logger
+	writes sync.WaitGroup
+}
+
+// NewBucket creates a cache storing rendered images in the bucket of the store
+func NewBucket(store BucketStore, bucket string, logger *slog.Logger) *Bucket {
+	return &Bucket{store: store, bucket: bucket, logger: logger}
+}
+
+// Get checks for the entry with a HEAD request before downloading it
+func (b *Bucket) Get(ctx context.Context, key string) (*Entry, bool) {
+	info, err := b.store.HeadObject(ctx, b.bucket, key)
+	if err != nil {
+		return nil, false
+	}
+	// Objects without ETag have not been written by the service
+	etag := info.Metadata[metadataETag]
+	if etag == "" {
+		return nil, false
+	}
+
+	object, err := b.store.GetObject(ctx, b.bucket, key)
+	if err != nil {
+		b.logger.Warn("error loading rendered image from result bucket", "bucket", b.bucket, "key", key, "error", err)
+		return nil, false
+	}
+	defer object.Body.Close()
+
+	data, err := io.ReadAll(object.Body)
+	if err != nil {
+		b.logger.Warn("error loading rendered image from result bucket", "bucket", b.bucket, "key", key, "error", err)
+		return nil, false
+	}
+	entry := &Entry{Data: data, ContentType: info.ContentType, ETag: etag}
+	if lastModified, err := time.Parse(time.RFC3339, info.Metadata[metadataLastModified]); err == nil {
+		entry.LastModified = lastModified
+	}
+	return entry, true
+}
+
+// Set writes the entry in the background, so the response is not delayed by the upload
+func (b *Bucket) Set(ctx context.Context, key string, entry *Entry) {
+	b.writes.Add(1)
+	go func() {
+		defer b.writes.Done()
+
+		// The request context ends with the response
+		ctx, cancel := context.WithTimeout(context.Background(), bucketWriteTimeout)
+		defer cancel()
+
+		info := storage.ObjectInfo{
+			ContentType: entry.ContentType,
+			Metadata:    map[string]string{metadataETag: entry.ETag},
+		}
+		if !entry.LastModified.IsZero() {
+			info.Metadata[metadataLastModified] = entry.LastModified.UTC().Format(time.RFC3339)
+		}
+		if err := b.store.PutObject(ctx, b.bucket, key, entry.Data, info); err != nil {
+			b.logger.Warn("error writing rendered image to result bucket", "bucket", b.bucket, "key", key, "error", err)
+		}
+	}()
+}
+
+// Wait blocks until all pending writes are done
+func (b *Bucket) Wait() {
+	b.writes.Wait()
+}
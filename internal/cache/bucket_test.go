@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spossner/img-sizer/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore is a bucket store keeping the objects in memory and counting the requests
+type memoryStore struct {
+	mu      sync.Mutex
+	objects map[string]storedObject
+	heads   int
+	gets    int
+}
+
+type storedObject struct {
+	data []byte
+	info storage.ObjectInfo
+}
+
+var errNotFound = errors.New("not found")
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{objects: make(map[string]storedObject)}
+}
+
+func (s *memoryStore) GetObject(ctx context.Context, bucket, key string) (*storage.Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gets++
+	object, ok := s.objects[bucket+"/"+key]
+	if !ok {
+		return nil, errNotFound
+	}
+	return &storage.Object{ObjectInfo: object.info, Body: io.NopCloser(bytes.NewReader(object.data))}, nil
+}
+
+func (s *memoryStore) HeadObject(ctx context.Context, bucket, key string) (*storage.ObjectInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.heads++
+	object, ok := s.objects[bucket+"/"+key]
+	if !ok {
+		return nil, errNotFound
+	}
+	return &object.info, nil
+}
+
+func (s *memoryStore) PutObject(ctx context.Context, bucket, key string, data []byte, info storage.ObjectInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info.ContentLength = int64(len(data))
+	s.objects[bucket+"/"+key] = storedObject{data: data, info: info}
+	return nil
+}
+
+func TestBucket(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	b := NewBucket(store, "results", slog.Default())
+
+	_, ok := b.Get(ctx, "aa")
+	assert.False(t, ok, "missing object should miss")
+	assert.Equal(t, 0, store.gets, "missing object should only be checked with HEAD")
+
+	entry := &Entry{Data: []byte("image"), ContentType: "image/webp", ETag: `"abc"`, LastModified: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)}
+	b.Set(ctx, "aa", entry)
+	b.Wait()
+
+	stored, ok := store.objects["results/aa"]
+	require.True(t, ok, "entry should be written to the bucket")
+	assert.Equal(t, "image/webp", stored.info.ContentType)
+	assert.Equal(t, `"abc"`, stored.info.Metadata[metadataETag])
+
+	cached, ok := b.Get(ctx, "aa")
+	assert.True(t, ok)
+	assert.Equal(t, entry, cached)
+}
+
+func TestBucketForeignObject(t *testing.T) {
+	store := newMemoryStore()
+	store.objects["results/aa"] = storedObject{data: []byte("image"), info: storage.ObjectInfo{ContentType: "image/jpeg"}}
+	b := NewBucket(store, "results", slog.Default())
+
+	_, ok := b.Get(context.Background(), "aa")
+	assert.False(t, ok, "object without ETag metadata should miss")
+}
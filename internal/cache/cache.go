@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/spossner/img-sizer/internal/config"
+)
+
+// Entry is a rendered image with the headers needed to serve it
+type Entry struct {
+	Data        []byte
+	ContentType string
+	ETag        string
+	// LastModified is the modification time of the source image, zero if unknown
+	LastModified time.Time
+}
+
+// Cache stores rendered images by key
+type Cache interface {
+	// Get returns the entry of the key, ok is false on a miss
+	Get(ctx context.Context, key string) (entry *Entry, ok bool)
+	// Set stores the entry under the key, entries not fitting the cache are dropped
+	Set(ctx context.Context, key string, entry *Entry)
+}
+
+// Key returns the cache key of the rendering of the source URL with the given params.
+// The params string has to include the output format. It is the same string the ETag is calculated from,
+// so entries cached for a key carry the ETag of a fresh rendering.
+func Key(sourceURL, params string) string {
+	hash := sha256.New()
+	hash.Write([]byte(sourceURL))
+	hash.Write([]byte{0})
+	hash.Write([]byte(params))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// New creates the cache tiers configured in cfg, a disabled cache never hits
+func New(cfg config.Cache) (Cache, error) {
+	var tiers Tiered
+	if cfg.Memory.MaxBytes > 0 {
+		tiers = append(tiers, NewMemory(cfg.Memory.MaxBytes, cfg.Memory.TTL))
+	}
+	if cfg.Disk.Dir != "" && cfg.Disk.MaxBytes > 0 {
+		disk, err := NewDisk(cfg.Disk.Dir, cfg.Disk.MaxBytes, cfg.Disk.MaxAge)
+		if err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, disk)
+	}
+
+	switch len(tiers) {
+	case 0:
+		return Nop{}, nil
+	case 1:
+		return tiers[0], nil
+	}
+	return tiers, nil
+}
+
+// Tiered looks up the caches in order, from the fastest to the slowest
+type Tiered []Cache
+
+// Get returns the entry of the first cache having the key and stores it in the faster caches
+func (t Tiered) Get(ctx context.Context, key string) (*Entry, bool) {
+	for i, tier := range t {
+		if entry, ok := tier.Get(ctx, key); ok {
+			for _, faster := range t[:i] {
+				faster.Set(ctx, key, entry)
+			}
+			return entry, true
+		}
+	}
+	return nil, false
+}
+
+// Set stores the entry in all caches
+func (t Tiered) Set(ctx context.Context, key string, entry *Entry) {
+	for _, tier := range t {
+		tier.Set(ctx, key, entry)
+	}
+}
+
+// Nop is a cache that stores nothing
+type Nop struct{}
+
+func (Nop) Get(ctx context.Context, key string) (*Entry, bool) { return nil, false }
+
+func (Nop) Set(ctx context.Context, key string, entry *Entry) {}
+
+// size returns the approximate memory used by the entry
+func (e *Entry) size(key string) int64 {
+	return int64(len(key) + len(e.Data) + len(e.ContentType) + len(e.ETag))
+}
+
+// expired reports whether an entry stored at the given time is outdated, a ttl of zero never expires
+func expired(stored time.Time, ttl time.Duration, now time.Time) bool {
+	return ttl > 0 && now.Sub(stored) >= ttl
+}
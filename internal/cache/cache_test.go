@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spossner/img-sizer/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKey(t *testing.T) {
+	key := Key("https://example.com/a.jpg", "100x100-fjpeg")
+
+	assert.Len(t, key, 64)
+	assert.Equal(t, key, Key("https://example.com/a.jpg", "100x100-fjpeg"), "key should be deterministic")
+	assert.NotEqual(t, key, Key("https://example.com/a.jpg", "100x100-fwebp"), "key should depend on the params")
+	assert.NotEqual(t, key, Key("https://example.com/b.jpg", "100x100-fjpeg"), "key should depend on the source")
+	assert.NotEqual(t, Key("ab", "c"), Key("a", "bc"), "source and params should be separated")
+}
+
+func TestNew(t *testing.T) {
+	memory := config.MemoryCache{MaxBytes: 1024, TTL: time.Hour}
+	disk := config.DiskCache{Dir: t.TempDir(), MaxBytes: 1024}
+
+	tests := []struct {
+		name     string
+		cfg      config.Cache
+		expected Cache
+	}{
+		{name: "disabled without size", cfg: config.Cache{}, expected: Nop{}},
+		{name: "memory only", cfg: config.Cache{Memory: memory}, expected: &Memory{}},
+		{name: "disk only", cfg: config.Cache{Disk: disk}, expected: &Disk{}},
+		{name: "memory and disk", cfg: config.Cache{Memory: memory, Disk: disk}, expected: Tiered{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.cfg)
+			require.NoError(t, err)
+			assert.IsType(t, tt.expected, c)
+		})
+	}
+}
+
+func TestNop(t *testing.T) {
+
+	nop := Nop{}
+	nop.Set(context.Background(), "a", &Entry{})
+	_, ok := nop.Get(context.Background(), "a")
+	assert.False(t, ok)
+}
+
+func TestTiered(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemory(1024, 0)
+	disk, err := NewDisk(t.TempDir(), 1024, 0)
+	require.NoError(t, err)
+	tiered := Tiered{memory, disk}
+
+	entry := &Entry{Data: []byte("image"), ContentType: "image/jpeg", ETag: `"abc"`}
+	tiered.Set(ctx, "a", entry)
+	_, ok := memory.Get(ctx, "a")
+	assert.True(t, ok, "entry should be stored in memory")
+	_, ok = disk.Get(ctx, "a")
+	assert.True(t, ok, "entry should be stored on disk")
+
+	// Entries only found on disk, e.g. after a restart, are loaded into memory
+	disk.Set(ctx, "b", entry)
+	cached, ok := tiered.Get(ctx, "b")
+	assert.True(t, ok)
+	assert.Equal(t, entry, cached)
+	_, ok = memory.Get(ctx, "b")
+	assert.True(t, ok, "disk hit should be stored in memory")
+
+	_, ok = tiered.Get(ctx, "c")
+	assert.False(t, ok)
+}
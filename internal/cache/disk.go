@@ -0,0 +1,229 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// diskLowWatermark is the share of the maximum size the disk cache is reduced to when full
+	diskLowWatermark = 0.9
+	// diskTempPrefix marks files being written, they are renamed into place when complete
+	diskTempPrefix = ".tmp-"
+)
+
+// Disk is a cache of files in a local directory. Files are written atomically, so the directory
+// survives restarts and can be shared by processes on the same node. When the directory exceeds
+// its maximum size, the least recently used files are removed.
+type Disk struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+	now      func() time.Time
+
+	mu sync.Mutex
+	// size is the estimated size of the directory, other processes may add files
+	size int64
+}
+
+// NewDisk creates a disk cache in dir holding up to maxBytes, entries expire after maxAge unless maxAge is zero
+func NewDisk(dir string, maxBytes int64, maxAge time.Duration) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating cache directory: %w", err)
+	}
+
+	d := &Disk{dir: dir, maxBytes: maxBytes, maxAge: maxAge, now: time.Now}
+	files, err := d.files()
+	if err != nil {
+		return nil, fmt.Errorf("error reading cache directory: %w", err)
+	}
+	for _, file := range files {
+		d.size += file.size
+	}
+	return d, nil
+}
+
+// Get reads the entry of the key and marks it as recently used
+func (d *Disk) Get(ctx context.Context, key string) (*Entry, bool) {
+	path := d.path(key)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer file.Close()
+
+	entry, created, err := readEntry(file)
+	if err != nil || expired(created, d.maxAge, d.now()) {
+		os.Remove(path)
+		return nil, false
+	}
+
+	// The modification time tracks the last access for the LRU eviction
+	now := d.now()
+	os.Chtimes(path, now, now)
+	return entry, true
+}
+
+// Set writes the entry and evicts the least recently used entries if the directory exceeds the size limit
+func (d *Disk) Set(ctx context.Context, key string, entry *Entry) {
+	size := entry.size(key)
+	if size > d.maxBytes {
+		return
+	}
+
+	path := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), diskTempPrefix)
+	if err != nil {
+		return
+	}
+	now := d.now()
+	if err := writeEntry(file, entry, now); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		os.Remove(file.Name())
+		return
+	}
+	os.Chtimes(path, now, now)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.size += size
+	if d.size > d.maxBytes {
+		d.evict()
+	}
+}
+
+// evict removes expired entries and the least recently used ones until the directory is below the low watermark
+func (d *Disk) evict() {
+	files, err := d.files()
+	if err != nil {
+		return
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modified.Before(files[j].modified) })
+
+	var total int64
+	for _, file := range files {
+		total += file.size
+	}
+	limit := int64(float64(d.maxBytes) * diskLowWatermark)
+	now := d.now()
+	for _, file := range files {
+		// Files not accessed within max age have been created before, younger ones expire on access
+		if total <= limit && !expired(file.modified, d.maxAge, now) {
+			continue
+		}
+		if err := os.Remove(file.path); err == nil || os.IsNotExist(err) {
+			total -= file.size
+		}
+	}
+	d.size = total
+}
+
+type diskFile struct {
+	path     string
+	size     int64
+	modified time.Time
+}
+
+// files lists the cache entries, stale temporary files of aborted writes are removed
+func (d *Disk) files() ([]diskFile, error) {
+	var files []diskFile
+	err := filepath.WalkDir(d.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), diskTempPrefix) {
+			if d.now().Sub(info.ModTime()) > time.Hour {
+				os.Remove(path)
+			}
+			return nil
+		}
+		files = append(files, diskFile{path: path, size: info.Size(), modified: info.ModTime()})
+		return nil
+	})
+	return files, err
+}
+
+// path returns the file of the key, files are spread over subdirectories by the key prefix
+func (d *Disk) path(key string) string {
+	if len(key) < 2 {
+		return filepath.Join(d.dir, key)
+	}
+	return filepath.Join(d.dir, key[:2], key)
+}
+
+// writeEntry writes the content type, ETag, last modification and creation time as header lines followed by the data
+func writeEntry(w io.Writer, entry *Entry, created time.Time) error {
+	var lastModified int64
+	if !entry.LastModified.IsZero() {
+		lastModified = entry.LastModified.UnixNano()
+	}
+	if _, err := fmt.Fprintf(w, "%s\n%s\n%d\n%d\n", entry.ContentType, entry.ETag, lastModified, created.UnixNano()); err != nil {
+		return err
+	}
+	_, err := w.Write(entry.Data)
+	return err
+}
+
+// readEntry reads an entry written by writeEntry
+func readEntry(r io.Reader) (*Entry, time.Time, error) {
+	reader := bufio.NewReader(r)
+	var header [4]string
+	for i := range header {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("error reading cache entry header: %w", err)
+		}
+		header[i] = strings.TrimSuffix(line, "\n")
+	}
+	lastModified, err := strconv.ParseInt(header[2], 10, 64)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid cache entry modification time: %w", err)
+	}
+	created, err := strconv.ParseInt(header[3], 10, 64)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid cache entry creation time: %w", err)
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("error reading cache entry: %w", err)
+	}
+
+	entry := &Entry{Data: data, ContentType: header[0], ETag: header[1]}
+	if lastModified != 0 {
+		entry.LastModified = time.Unix(0, lastModified).UTC()
+	}
+	return entry, time.Unix(0, created), nil
+}
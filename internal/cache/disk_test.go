@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskGetSet(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	d, err := NewDisk(dir, 1024, 0)
+	require.NoError(t, err)
+
+	_, ok := d.Get(ctx, "abcdef")
+	assert.False(t, ok, "empty cache should miss")
+
+	entry := &Entry{Data: []byte("image\ndata\n"), ContentType: "image/jpeg", ETag: `"abc"`, LastModified: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)}
+	d.Set(ctx, "abcdef", entry)
+
+	cached, ok := d.Get(ctx, "abcdef")
+	assert.True(t, ok)
+	assert.Equal(t, entry, cached)
+	assert.FileExists(t, filepath.Join(dir, "ab", "abcdef"), "entries should be spread over subdirectories")
+
+	// Entries survive a restart
+	restarted, err := NewDisk(dir, 1024, 0)
+	require.NoError(t, err)
+	cached, ok = restarted.Get(ctx, "abcdef")
+	assert.True(t, ok)
+	assert.Equal(t, entry, cached)
+	assert.Positive(t, restarted.size, "size should be read from the directory")
+}
+
+func TestDiskEviction(t *testing.T) {
+	ctx := context.Background()
+	// Room for three entries of about 333 bytes on disk
+	d, err := NewDisk(t.TempDir(), 1200, 0)
+	require.NoError(t, err)
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	for _, key := range []string{"aa", "bb", "cc"} {
+		d.Set(ctx, key, createEntry(300))
+		now = now.Add(time.Second)
+	}
+
+	// Mark aa as recently used, so bb is evicted first
+	_, ok := d.Get(ctx, "aa")
+	assert.True(t, ok)
+	now = now.Add(time.Second)
+	d.Set(ctx, "dd", createEntry(300))
+
+	_, ok = d.Get(ctx, "bb")
+	assert.False(t, ok, "least recently used entry should be evicted")
+	for _, key := range []string{"aa", "cc", "dd"} {
+		_, ok = d.Get(ctx, key)
+		assert.True(t, ok, key)
+	}
+	assert.LessOrEqual(t, d.size, int64(1080), "size should be reduced to the low watermark")
+}
+
+func TestDiskMaxAge(t *testing.T) {
+	ctx := context.Background()
+	d, err := NewDisk(t.TempDir(), 1024, time.Hour)
+	require.NoError(t, err)
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	d.Set(ctx, "aa", createEntry(10))
+
+	// Access does not extend the age of an entry
+	now = now.Add(30 * time.Minute)
+	_, ok := d.Get(ctx, "aa")
+	assert.True(t, ok, "entry within max age should hit")
+
+	now = now.Add(30 * time.Minute)
+	_, ok = d.Get(ctx, "aa")
+	assert.False(t, ok, "expired entry should miss")
+	assert.NoFileExists(t, d.path("aa"), "expired entry should be removed")
+}
+
+func TestDiskTooLarge(t *testing.T) {
+	ctx := context.Background()
+	d, err := NewDisk(t.TempDir(), 100, 0)
+	require.NoError(t, err)
+
+	d.Set(ctx, "aa", createEntry(200))
+
+	_, ok := d.Get(ctx, "aa")
+	assert.False(t, ok, "entry exceeding the cache size should not be stored")
+}
+
+func TestDiskUnknownLastModified(t *testing.T) {
+	ctx := context.Background()
+	d, err := NewDisk(t.TempDir(), 1024, 0)
+	require.NoError(t, err)
+
+	d.Set(ctx, "aa", &Entry{Data: []byte("image")})
+
+	cached, ok := d.Get(ctx, "aa")
+	assert.True(t, ok)
+	assert.True(t, cached.LastModified.IsZero(), "unknown modification time should stay zero")
+}
+
+func TestDiskCorruptEntry(t *testing.T) {
+	ctx := context.Background()
+	d, err := NewDisk(t.TempDir(), 1024, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(d.path("aa")), 0o755))
+	require.NoError(t, os.WriteFile(d.path("aa"), []byte("truncated"), 0o644))
+
+	_, ok := d.Get(ctx, "aa")
+	assert.False(t, ok, "corrupt entry should miss")
+	assert.NoFileExists(t, d.path("aa"), "corrupt entry should be removed")
+}
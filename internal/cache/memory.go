@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory is an in-memory LRU cache limited by the total size of its entries
+type Memory struct {
+	mu       sync.Mutex
+	maxBytes int64
+	ttl      time.Duration
+	size     int64
+	items    map[string]*list.Element
+	lru      *list.List
+	now      func() time.Time
+}
+
+type memoryItem struct {
+	key    string
+	entry  *Entry
+	size   int64
+	stored time.Time
+}
+
+// NewMemory creates an in-memory cache holding up to maxBytes, entries expire after ttl unless ttl is zero
+func NewMemory(maxBytes int64, ttl time.Duration) *Memory {
+	return &Memory{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		items:    make(map[string]*list.Element),
+		lru:      list.New(),
+		now:      time.Now,
+	}
+}
+
+// Get returns the entry of the key and marks it as recently used
+func (m *Memory) Get(ctx context.Context, key string) (*Entry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := element.Value.(*memoryItem)
+	if expired(item.stored, m.ttl, m.now()) {
+		m.remove(element)
+		return nil, false
+	}
+	m.lru.MoveToFront(element)
+	return item.entry, true
+}
+
+// Set stores the entry and evicts the least recently used entries exceeding the size limit
+func (m *Memory) Set(ctx context.Context, key string, entry *Entry) {
+	size := entry.size(key)
+	if size > m.maxBytes {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if element, ok := m.items[key]; ok {
+		m.remove(element)
+	}
+	m.items[key] = m.lru.PushFront(&memoryItem{key: key, entry: entry, size: size, stored: m.now()})
+	m.size += size
+
+	for m.size > m.maxBytes {
+		m.remove(m.lru.Back())
+	}
+}
+
+// Len returns the number of cached entries
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lru.Len()
+}
+
+func (m *Memory) remove(element *list.Element) {
+	item := m.lru.Remove(element).(*memoryItem)
+	delete(m.items, item.key)
+	m.size -= item.size
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createEntry(size int) *Entry {
+	return &Entry{Data: make([]byte, size)}
+}
+
+func TestMemoryGetSet(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(1024, 0)
+
+	_, ok := m.Get(ctx, "a")
+	assert.False(t, ok, "empty cache should miss")
+
+	entry := &Entry{Data: []byte("image"), ContentType: "image/jpeg", ETag: `"abc"`}
+	m.Set(ctx, "a", entry)
+
+	cached, ok := m.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, entry, cached)
+}
+
+func TestMemoryEviction(t *testing.T) {
+	ctx := context.Background()
+	// Each entry uses 101 bytes including its key
+	m := NewMemory(303, 0)
+
+	m.Set(ctx, "a", createEntry(100))
+	m.Set(ctx, "b", createEntry(100))
+	m.Set(ctx, "c", createEntry(100))
+	assert.Equal(t, 3, m.Len())
+
+	// Mark a as recently used, so b is evicted first
+	_, ok := m.Get(ctx, "a")
+	assert.True(t, ok)
+	m.Set(ctx, "d", createEntry(100))
+
+	_, ok = m.Get(ctx, "b")
+	assert.False(t, ok, "least recently used entry should be evicted")
+	for _, key := range []string{"a", "c", "d"} {
+		_, ok = m.Get(ctx, key)
+		assert.True(t, ok, key)
+	}
+
+	// A large entry evicts several small ones
+	m.Set(ctx, "e", createEntry(250))
+	assert.Equal(t, 1, m.Len())
+	assert.Equal(t, int64(251), m.size)
+}
+
+func TestMemoryReplace(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(1024, 0)
+
+	m.Set(ctx, "a", createEntry(100))
+	m.Set(ctx, "a", createEntry(200))
+
+	entry, ok := m.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Len(t, entry.Data, 200)
+	assert.Equal(t, 1, m.Len())
+	assert.Equal(t, int64(201), m.size)
+}
+
+func TestMemoryTooLarge(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(100, 0)
+
+	m.Set(ctx, "a", createEntry(50))
+	m.Set(ctx, "b", createEntry(200))
+
+	_, ok := m.Get(ctx, "b")
+	assert.False(t, ok, "entry exceeding the cache size should not be stored")
+	_, ok = m.Get(ctx, "a")
+	assert.True(t, ok, "existing entries should be kept")
+}
+
+func TestMemoryTTL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	m := NewMemory(1024, time.Minute)
+	m.now = func() time.Time { return now }
+
+	m.Set(ctx, "a", createEntry(10))
+
+	now = now.Add(59 * time.Second)
+	_, ok := m.Get(ctx, "a")
+	assert.True(t, ok, "entry within ttl should hit")
+
+	now = now.Add(time.Second)
+	_, ok = m.Get(ctx, "a")
+	assert.False(t, ok, "expired entry should miss")
+	assert.Equal(t, 0, m.Len(), "expired entry should be removed")
+	assert.Equal(t, int64(0), m.size)
+}
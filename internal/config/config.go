@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"net"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
 	"time"
 
@@ -43,10 +45,83 @@ func (r *RateLimit) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// CacheControl is the Cache-Control policy of rendered images, ErrorMaxAge is the negative-cache TTL of error responses
+type CacheControl struct {
+	MaxAge               time.Duration `json:"max_age"`
+	SMaxAge              time.Duration `json:"s_maxage"`
+	StaleWhileRevalidate time.Duration `json:"stale_while_revalidate"`
+	StaleIfError         time.Duration `json:"stale_if_error"`
+	Immutable            bool          `json:"immutable"`
+	ErrorMaxAge          time.Duration `json:"error_max_age"`
+}
+
+func (p *CacheControl) UnmarshalJSON(data []byte) error {
+	type Alias CacheControl
+	aux := &struct {
+		MaxAge               string `json:"max_age"`
+		SMaxAge              string `json:"s_maxage"`
+		StaleWhileRevalidate string `json:"stale_while_revalidate"`
+		StaleIfError         string `json:"stale_if_error"`
+		ErrorMaxAge          string `json:"error_max_age"`
+		*Alias
+	}{
+		Alias: (*Alias)(p),
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	return parseDurations(
+		durationField{aux.MaxAge, &p.MaxAge},
+		durationField{aux.SMaxAge, &p.SMaxAge},
+		durationField{aux.StaleWhileRevalidate, &p.StaleWhileRevalidate},
+		durationField{aux.StaleIfError, &p.StaleIfError},
+		durationField{aux.ErrorMaxAge, &p.ErrorMaxAge},
+	)
+}
+
+// durationField is a duration string and the field it is parsed into
+type durationField struct {
+	value  string
+	target *time.Duration
+}
+
+// parseDurations parses the duration strings into their targets in order, targets of empty strings keep their defaults
+func parseDurations(fields ...durationField) error {
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(field.value)
+		if err != nil {
+			return fmt.Errorf("invalid duration format: %v", err)
+		}
+		*field.target = duration
+	}
+	return nil
+}
+
+// Storage backends a source can be loaded from
+const (
+	BackendS3 = "s3"
+	BackendFS = "fs"
+)
+
 type SourceConfig struct {
+	// Pattern matches the whole host name without port
 	Pattern *regexp.Regexp `json:"pattern"`
 	Matcher *regexp.Regexp `json:"matcher,omitempty"`
 	Bucket  string         `json:"bucket,omitempty"`
+	Backend string         `json:"backend,omitempty"`
+	Root    string         `json:"root,omitempty"`
+
+	Region                string        `json:"region,omitempty"`
+	Endpoint              string        `json:"endpoint,omitempty"`
+	Profile               string        `json:"profile,omitempty"`
+	AssumeRoleARN         string        `json:"assume_role_arn,omitempty"`
+	IgnoreExifOrientation bool          `json:"ignore_exif_orientation,omitempty"`
+	MaxSourceBytes        int64         `json:"max_source_bytes,omitempty"`
+	CacheControl          *CacheControl `json:"cache_control,omitempty"`
 }
 
 func (s *SourceConfig) UnmarshalJSON(data []byte) error {
@@ -67,7 +142,7 @@ func (s *SourceConfig) UnmarshalJSON(data []byte) error {
 		// Convert wildcard pattern to regex
 		pattern := strings.ReplaceAll(aux.Pattern, ".", "\\.")
 		pattern = strings.ReplaceAll(pattern, "*", "[a-zA-Z0-9-]+")
-		pattern = "^" + pattern + ".*$"
+		pattern = "^" + pattern + "$"
 
 		re, err := regexp.Compile(pattern)
 		if err != nil {
@@ -82,23 +157,220 @@ func (s *SourceConfig) UnmarshalJSON(data []byte) error {
 		}
 		s.Matcher = re
 	}
+
+	switch s.Backend {
+	case "", BackendS3:
+	case BackendFS:
+		if s.Root == "" {
+			return fmt.Errorf("root is required for the %s backend", BackendFS)
+		}
+	default:
+		return fmt.Errorf("unknown backend %s", s.Backend)
+	}
 	return nil
 }
 
+// MatchesHost reports whether the host name matches the pattern as a whole, the port is ignored.
+// Host names only starting with the pattern like images.example.com.attacker.net don't match.
+func (s *SourceConfig) MatchesHost(host string) bool {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	return s.Pattern != nil && s.Pattern.MatchString(strings.ToLower(host))
+}
+
+// IsFS reports whether the source is served from the local filesystem
+func (s *SourceConfig) IsFS() bool {
+	return s.Backend == BackendFS
+}
+
 type Jpeg struct {
 	Background string `json:"background"`
 	Quality    int    `json:"quality"`
 }
 
+type Webp struct {
+	Quality  int  `json:"quality"`
+	Lossless bool `json:"lossless"`
+}
+
+type Png struct {
+	CompressionLevel string `json:"compression_level"`
+}
+
+type MemoryCache struct {
+	MaxBytes int64         `json:"max_bytes"`
+	TTL      time.Duration `json:"ttl"`
+}
+
+func (m *MemoryCache) UnmarshalJSON(data []byte) error {
+	type Alias MemoryCache
+	aux := &struct {
+		TTL string `json:"ttl"`
+		*Alias
+	}{
+		Alias: (*Alias)(m),
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	return parseDurations(durationField{aux.TTL, &m.TTL})
+}
+
+type DiskCache struct {
+	Dir      string        `json:"dir"`
+	MaxBytes int64         `json:"max_bytes"`
+	MaxAge   time.Duration `json:"max_age"`
+}
+
+func (d *DiskCache) UnmarshalJSON(data []byte) error {
+	type Alias DiskCache
+	aux := &struct {
+		MaxAge string `json:"max_age"`
+		*Alias
+	}{
+		Alias: (*Alias)(d),
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	return parseDurations(durationField{aux.MaxAge, &d.MaxAge})
+}
+
+type Cache struct {
+	Memory MemoryCache `json:"memory"`
+	Disk   DiskCache   `json:"disk"`
+}
+
+type S3 struct {
+	Endpoint           string `json:"endpoint"`
+	UsePathStyle       bool   `json:"use_path_style"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+type HTTPSource struct {
+	ConnectTimeout  time.Duration `json:"connect_timeout"`
+	TLSTimeout      time.Duration `json:"tls_timeout"`
+	Timeout         time.Duration `json:"timeout"`
+	MaxRedirects    int           `json:"max_redirects"`
+	UserAgent       string        `json:"user_agent"`
+	AllowedNetworks []*net.IPNet  `json:"allowed_networks"`
+}
+
+func (h *HTTPSource) UnmarshalJSON(data []byte) error {
+	type Alias HTTPSource
+	aux := &struct {
+		ConnectTimeout  string   `json:"connect_timeout"`
+		TLSTimeout      string   `json:"tls_timeout"`
+		Timeout         string   `json:"timeout"`
+		AllowedNetworks []string `json:"allowed_networks"`
+		*Alias
+	}{
+		Alias: (*Alias)(h),
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	if err := parseDurations(
+		durationField{aux.ConnectTimeout, &h.ConnectTimeout},
+		durationField{aux.TLSTimeout, &h.TLSTimeout},
+		durationField{aux.Timeout, &h.Timeout},
+	); err != nil {
+		return err
+	}
+
+	// Accept plain IP addresses as single host networks
+	for _, value := range aux.AllowedNetworks {
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil && ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return fmt.Errorf("invalid allowed network %s: %v", value, err)
+		}
+		h.AllowedNetworks = append(h.AllowedNetworks, network)
+	}
+	return nil
+}
+
+// Processing bounds the number of images processed concurrently
+type Processing struct {
+	Concurrency  int           `json:"concurrency"`
+	QueueDepth   int           `json:"queue_depth"`
+	QueueTimeout time.Duration `json:"queue_timeout"`
+	RetryAfter   time.Duration `json:"retry_after"`
+	// MemoryBudget limits the estimated memory of all images decoded at the same time in bytes, 0 means unlimited
+	MemoryBudget int64 `json:"memory_budget"`
+}
+
+func (p *Processing) UnmarshalJSON(data []byte) error {
+	type Alias Processing
+	aux := &struct {
+		QueueTimeout string `json:"queue_timeout"`
+		RetryAfter   string `json:"retry_after"`
+		*Alias
+	}{
+		Alias: (*Alias)(p),
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	return parseDurations(
+		durationField{aux.QueueTimeout, &p.QueueTimeout},
+		durationField{aux.RetryAfter, &p.RetryAfter},
+	)
+}
+
 type Config struct {
 	AllowedSources     []SourceConfig `json:"allowed_sources"`
 	AllowedDimensions  []Dimension    `json:"allowed_dimensions"`
 	AllowAllDimensions bool           `json:"allow_all_dimensions"`
 	MaxInputDimension  int            `json:"max_input_dimension"`
+	MaxInputPixels     int64          `json:"max_input_pixels"`
+	MaxSourceBytes     int64          `json:"max_source_bytes"`
 	MaxOutputDimension int            `json:"max_output_dimension"`
 	RateLimit          RateLimit      `json:"rate_limit"`
 	Jpeg               Jpeg           `json:"jpeg"`
-	Logger             *slog.Logger   `json:"-"`
+	Webp               Webp           `json:"webp"`
+	Png                Png            `json:"png"`
+	Cache              Cache          `json:"cache"`
+	ResultBucket       string         `json:"result_bucket"`
+	CacheControl       CacheControl   `json:"cache_control"`
+	Processing         Processing     `json:"processing"`
+	// RouteCacheControl overrides the cache control policy for the route paths
+	RouteCacheControl map[string]*CacheControl `json:"route_cache_control"`
+	S3                S3                       `json:"s3"`
+	HTTPSource        HTTPSource               `json:"http_source"`
+	Logger            *slog.Logger             `json:"-"`
+}
+
+// CacheControlPolicy returns the cache control policy of the route, the policy of the source takes precedence if set
+func (c *Config) CacheControlPolicy(route string, source *SourceConfig) CacheControl {
+	if source != nil && source.CacheControl != nil {
+		return *source.CacheControl
+	}
+	if policy, ok := c.RouteCacheControl[route]; ok && policy != nil {
+		return *policy
+	}
+	return c.CacheControl
+}
+
+// IsAllowedHost checks if the host matches the pattern of any allowed source
+func (c *Config) IsAllowedHost(host string) bool {
+	for i := range c.AllowedSources {
+		if c.AllowedSources[i].MatchesHost(host) {
+			return true
+		}
+	}
+	return false
 }
 
 func Load(logger *slog.Logger) (*Config, error) {
@@ -122,8 +394,31 @@ func Load(logger *slog.Logger) (*Config, error) {
 		return nil, fmt.Errorf("error reading config file %s: %v", configPath, err)
 	}
 
-	// Parse config
-	var config Config
+	// Parse config on top of the defaults for optional blocks
+	config := Config{
+		HTTPSource: HTTPSource{
+			ConnectTimeout: 5 * time.Second,
+			TLSTimeout:     5 * time.Second,
+			Timeout:        30 * time.Second,
+			MaxRedirects:   5,
+			UserAgent:      "Image-Sizer",
+		},
+		CacheControl: CacheControl{
+			MaxAge:      30 * 24 * time.Hour,
+			Immutable:   true,
+			ErrorMaxAge: time.Minute,
+		},
+		// The disk cache key doesn't change when a source is replaced, so entries have to expire
+		Cache: Cache{
+			Disk: DiskCache{MaxAge: 24 * time.Hour},
+		},
+		Processing: Processing{
+			Concurrency:  runtime.NumCPU(),
+			QueueDepth:   100,
+			QueueTimeout: 10 * time.Second,
+			RetryAfter:   5 * time.Second,
+		},
+	}
 	if err := json.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("error decoding config: %v", err)
 	}
@@ -131,6 +426,10 @@ func Load(logger *slog.Logger) (*Config, error) {
 	// Set logger
 	config.Logger = logger
 
+	if config.Cache.Disk.MaxBytes > 0 && config.Cache.Disk.MaxAge <= 0 {
+		return nil, fmt.Errorf("cache.disk.max_age must be positive")
+	}
+
 	// Set default rate limit if not configured
 	if config.RateLimit.MaxRequests == 0 {
 		config.RateLimit.MaxRequests = 300
@@ -139,8 +438,19 @@ func Load(logger *slog.Logger) (*Config, error) {
 		config.RateLimit.Window = 1 * time.Minute
 	}
 
+	// Set default webp quality if not configured
+	if config.Webp.Quality == 0 {
+		config.Webp.Quality = 75
+	}
+
+	if config.S3.InsecureSkipVerify {
+		logger.Warn("TLS certificate verification of the S3 endpoint is disabled", "endpoint", config.S3.Endpoint)
+	}
+
+	logger.Info("processing limits", "concurrency", config.Processing.Concurrency, "queue_depth", config.Processing.QueueDepth, "queue_timeout", config.Processing.QueueTimeout, "memory_budget", config.Processing.MemoryBudget)
+
 	for i, source := range config.AllowedSources {
-		logger.Info("allowed source", "index", i, "pattern", source.Pattern, "bucket", source.Bucket, "matcher", source.Matcher)
+		logger.Info("allowed source", "index", i, "pattern", source.Pattern, "bucket", source.Bucket, "backend", source.Backend, "root", source.Root, "region", source.Region, "endpoint", source.Endpoint, "profile", source.Profile, "assume_role_arn", source.AssumeRoleARN, "matcher", source.Matcher, "ignore_exif_orientation", source.IgnoreExifOrientation, "max_source_bytes", source.MaxSourceBytes)
 	}
 
 	return &config, nil
@@ -0,0 +1,235 @@
+package config
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadConfig loads the given config content with Load
+func loadConfig(t *testing.T, content string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	t.Setenv("CONFIG_PATH", path)
+	return Load(slog.Default())
+}
+
+func TestLoadDiskCacheMaxAge(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expected    time.Duration
+		expectError bool
+	}{
+		{
+			name:     "default",
+			content:  `{"cache": {"disk": {"dir": "/tmp/cache", "max_bytes": 1024}}}`,
+			expected: 24 * time.Hour,
+		},
+		{
+			name:     "configured",
+			content:  `{"cache": {"disk": {"dir": "/tmp/cache", "max_bytes": 1024, "max_age": "1h"}}}`,
+			expected: time.Hour,
+		},
+		{
+			name:        "no expiry",
+			content:     `{"cache": {"disk": {"dir": "/tmp/cache", "max_bytes": 1024, "max_age": "0s"}}}`,
+			expectError: true,
+		},
+		{
+			name:     "disabled disk cache",
+			content:  `{"cache": {"disk": {"max_age": "0s"}}}`,
+			expected: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadConfig(t, tt.content)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.Cache.Disk.MaxAge)
+		})
+	}
+}
+
+func TestParseDurations(t *testing.T) {
+	connect, timeout := 5*time.Second, time.Minute
+	err := parseDurations(
+		durationField{"1s", &connect},
+		durationField{"", &timeout},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, connect)
+	assert.Equal(t, time.Minute, timeout, "empty strings keep the default")
+
+	// The first invalid duration is reported
+	for range 10 {
+		err = parseDurations(
+			durationField{"first", &connect},
+			durationField{"second", &timeout},
+		)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `"first"`)
+	}
+}
+
+func TestHTTPSourceUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name             string
+		content          string
+		expectedNetworks []string
+		expectedTimeout  time.Duration
+		expectError      bool
+	}{
+		{
+			name:             "single IPv4 address",
+			content:          `{"allowed_networks": ["10.0.0.1"]}`,
+			expectedNetworks: []string{"10.0.0.1/32"},
+		},
+		{
+			name:             "single IPv6 address",
+			content:          `{"allowed_networks": ["fd00::1"]}`,
+			expectedNetworks: []string{"fd00::1/128"},
+		},
+		{
+			name:             "networks",
+			content:          `{"allowed_networks": ["10.0.0.0/8", "fd00::/8"]}`,
+			expectedNetworks: []string{"10.0.0.0/8", "fd00::/8"},
+		},
+		{
+			name:        "invalid network",
+			content:     `{"allowed_networks": ["10.0.0.0/33"]}`,
+			expectError: true,
+		},
+		{
+			name:        "invalid address",
+			content:     `{"allowed_networks": ["images.example.com"]}`,
+			expectError: true,
+		},
+		{
+			name:            "timeout",
+			content:         `{"timeout": "10s"}`,
+			expectedTimeout: 10 * time.Second,
+		},
+		{
+			name:        "invalid timeout",
+			content:     `{"timeout": "10"}`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var source HTTPSource
+			err := json.Unmarshal([]byte(tt.content), &source)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			networks := make([]string, 0, len(source.AllowedNetworks))
+			for _, network := range source.AllowedNetworks {
+				networks = append(networks, network.String())
+			}
+			assert.ElementsMatch(t, tt.expectedNetworks, networks)
+			assert.Equal(t, tt.expectedTimeout, source.Timeout)
+		})
+	}
+}
+
+func TestProcessingUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expected    Processing
+		expectError bool
+	}{
+		{
+			name:    "all values",
+			content: `{"concurrency": 4, "queue_depth": 20, "queue_timeout": "2s", "retry_after": "1s", "memory_budget": 1024}`,
+			expected: Processing{
+				Concurrency:  4,
+				QueueDepth:   20,
+				QueueTimeout: 2 * time.Second,
+				RetryAfter:   time.Second,
+				MemoryBudget: 1024,
+			},
+		},
+		{
+			name:        "invalid queue timeout",
+			content:     `{"queue_timeout": "2 seconds"}`,
+			expectError: true,
+		},
+		{
+			name:        "invalid retry after",
+			content:     `{"retry_after": "soon"}`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var processing Processing
+			err := json.Unmarshal([]byte(tt.content), &processing)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, processing)
+		})
+	}
+}
+
+func TestLoadKeepsDefaults(t *testing.T) {
+	cfg, err := loadConfig(t, `{
+		"http_source": {"timeout": "10s"},
+		"cache_control": {"max_age": "1h"},
+		"processing": {"concurrency": 2, "retry_after": "1s"}
+	}`)
+	require.NoError(t, err)
+
+	// Configured values
+	assert.Equal(t, 10*time.Second, cfg.HTTPSource.Timeout)
+	assert.Equal(t, time.Hour, cfg.CacheControl.MaxAge)
+	assert.Equal(t, 2, cfg.Processing.Concurrency)
+	assert.Equal(t, time.Second, cfg.Processing.RetryAfter)
+
+	// Defaults of the values left out
+	assert.Equal(t, 5*time.Second, cfg.HTTPSource.ConnectTimeout)
+	assert.Equal(t, 5*time.Second, cfg.HTTPSource.TLSTimeout)
+	assert.Equal(t, 5, cfg.HTTPSource.MaxRedirects)
+	assert.Equal(t, "Image-Sizer", cfg.HTTPSource.UserAgent)
+	assert.True(t, cfg.CacheControl.Immutable)
+	assert.Equal(t, time.Minute, cfg.CacheControl.ErrorMaxAge)
+	assert.Equal(t, 100, cfg.Processing.QueueDepth)
+	assert.Equal(t, 10*time.Second, cfg.Processing.QueueTimeout)
+	assert.Equal(t, 24*time.Hour, cfg.Cache.Disk.MaxAge)
+	assert.Equal(t, 300, cfg.RateLimit.MaxRequests)
+	assert.Equal(t, 75, cfg.Webp.Quality)
+}
+
+func TestLoadInvalidDuration(t *testing.T) {
+	for _, content := range []string{
+		`{"http_source": {"connect_timeout": "5"}}`,
+		`{"cache_control": {"error_max_age": "a minute"}}`,
+		`{"processing": {"queue_timeout": "-"}}`,
+		`{"cache": {"memory": {"ttl": "1 hour"}}}`,
+		`{"cache": {"disk": {"max_age": "1d"}}}`,
+	} {
+		_, err := loadConfig(t, content)
+		assert.Error(t, err, content)
+	}
+}
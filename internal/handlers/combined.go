@@ -3,7 +3,10 @@ package handlers
 import (
 	"image"
 
+	"github.com/spossner/img-sizer/internal/cache"
 	"github.com/spossner/img-sizer/internal/config"
+	"github.com/spossner/img-sizer/internal/handlers/helpers"
+	"github.com/spossner/img-sizer/internal/processing"
 	"github.com/spossner/img-sizer/internal/storage"
 
 	"github.com/gofiber/fiber/v2"
@@ -12,8 +15,24 @@ import (
 func combinedParamsParser(c *fiber.Ctx, cfg *config.Config) SizerParams {
 	width := c.QueryInt("width", 0)
 	height := c.QueryInt("height", 0)
-	quality := c.QueryInt("quality", cfg.Jpeg.Quality)
+
+	// Get output format - auto negotiates it from the Accept header
+	format, err := processing.ParseFormat(c.Query("format", string(processing.FormatJPEG)))
+	if err != nil {
+		format = processing.FormatJPEG
+	}
+	autoFormat := format == processing.FormatAuto
+	if autoFormat {
+		format = helpers.NegotiateFormat(c.Get(fiber.HeaderAccept))
+	}
+
+	quality := c.QueryInt("quality", defaultQuality(cfg, format))
+	lossless := format == processing.FormatWebP && c.QueryBool("lossless", cfg.Webp.Lossless)
 	bgColor := c.Query("background", cfg.Jpeg.Background)
+	if format.KeepsAlpha() {
+		// WebP and PNG keep their transparency unless a background is given explicitly
+		bgColor = c.Query("background")
+	}
 	// Get density parameter
 	density := c.QueryFloat("density", 1.0)
 	density = c.QueryFloat("scale", density)
@@ -21,6 +40,18 @@ func combinedParamsParser(c *fiber.Ctx, cfg *config.Config) SizerParams {
 		density = 1.0
 	}
 
+	// Get fit mode - defaults to fill (center crop)
+	fit, err := processing.ParseFitMode(c.Query("fit", string(processing.FitFill)))
+	if err != nil {
+		fit = processing.FitFill
+	}
+
+	// Get gravity for fill cropping - defaults to center
+	gravity, err := processing.ParseGravity(c.Query("gravity", "center"))
+	if err != nil {
+		gravity = processing.Gravity{}
+	}
+
 	// Calculate final dimensions with density
 	finalWidth := int(float64(width) * density)
 	finalHeight := int(float64(height) * density)
@@ -45,16 +76,21 @@ func combinedParamsParser(c *fiber.Ctx, cfg *config.Config) SizerParams {
 	crop := image.Rect(scaledX, scaledY, scaledX+scaledWidth, scaledY+scaledHeight)
 
 	return SizerParams{
-		Width:   finalWidth,
-		Height:  finalHeight,
-		Quality: quality,
-		BgColor: bgColor,
-		Density: density,
-		Scale:   scale,
-		Crop:    crop,
+		Width:      finalWidth,
+		Height:     finalHeight,
+		Quality:    quality,
+		BgColor:    bgColor,
+		Density:    density,
+		Scale:      scale,
+		Crop:       crop,
+		Fit:        fit,
+		Gravity:    gravity,
+		Format:     format,
+		Lossless:   lossless,
+		AutoFormat: autoFormat,
 	}
 }
 
-func GetCombinedHandler(cfg *config.Config, s3Client *storage.S3Client) fiber.Handler {
-	return GetImageSizerHandler(cfg, s3Client, combinedParamsParser)
+func GetCombinedHandler(cfg *config.Config, backends *storage.Backends, httpFetcher *storage.HTTPFetcher, outputCache cache.Cache, pool *processing.Pool, budget *processing.MemoryBudget) fiber.Handler {
+	return GetImageSizerHandler(cfg, backends, httpFetcher, outputCache, pool, budget, combinedParamsParser)
 }
@@ -5,7 +5,9 @@ import (
 	"testing"
 
 	"github.com/spossner/img-sizer/internal/config"
+	"github.com/spossner/img-sizer/internal/processing"
 
+	"github.com/disintegration/imaging"
 	"github.com/gofiber/fiber/v2"
 	"github.com/valyala/fasthttp"
 )
@@ -248,3 +250,172 @@ func TestCombinedParamsParserWithAllowAllDimensions(t *testing.T) {
 		})
 	}
 }
+
+func TestCombinedParamsParserFormat(t *testing.T) {
+	cfg := &config.Config{
+		MaxInputDimension:  5000,
+		MaxOutputDimension: 2000,
+		AllowAllDimensions: true,
+		Jpeg: config.Jpeg{
+			Quality:    70,
+			Background: "000000",
+		},
+		Webp: config.Webp{
+			Quality: 75,
+		},
+	}
+
+	tests := []struct {
+		name               string
+		query              string
+		accept             string
+		expectedFormat     processing.Format
+		expectedQuality    int
+		expectedAutoFormat bool
+	}{
+		{
+			name:            "jpeg by default",
+			query:           "width=800&height=600",
+			accept:          "image/webp,*/*",
+			expectedFormat:  processing.FormatJPEG,
+			expectedQuality: 70,
+		},
+		{
+			name:            "explicit webp format",
+			query:           "width=800&height=600&format=webp",
+			expectedFormat:  processing.FormatWebP,
+			expectedQuality: 75,
+		},
+		{
+			name:            "unknown format falls back to jpeg",
+			query:           "width=800&height=600&format=tiff",
+			expectedFormat:  processing.FormatJPEG,
+			expectedQuality: 70,
+		},
+		{
+			name:               "auto with webp support",
+			query:              "width=800&height=600&format=auto",
+			accept:             "image/avif,image/webp,image/apng,image/*,*/*;q=0.8",
+			expectedFormat:     processing.FormatWebP,
+			expectedQuality:    75,
+			expectedAutoFormat: true,
+		},
+		{
+			name:               "auto without accept header",
+			query:              "width=800&height=600&format=auto",
+			expectedFormat:     processing.FormatJPEG,
+			expectedQuality:    70,
+			expectedAutoFormat: true,
+		},
+		{
+			name:               "auto with png only",
+			query:              "width=800&height=600&format=auto&quality=90",
+			accept:             "image/png",
+			expectedFormat:     processing.FormatPNG,
+			expectedQuality:    90,
+			expectedAutoFormat: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			ctx := app.AcquireCtx(&fasthttp.RequestCtx{})
+			ctx.Request().SetRequestURI("?" + tt.query)
+			if tt.accept != "" {
+				ctx.Request().Header.Set(fiber.HeaderAccept, tt.accept)
+			}
+
+			params := combinedParamsParser(ctx, cfg)
+
+			if params.Format != tt.expectedFormat {
+				t.Errorf("Format = %v, want %v", params.Format, tt.expectedFormat)
+			}
+			if params.Quality != tt.expectedQuality {
+				t.Errorf("Quality = %v, want %v", params.Quality, tt.expectedQuality)
+			}
+			if params.AutoFormat != tt.expectedAutoFormat {
+				t.Errorf("AutoFormat = %v, want %v", params.AutoFormat, tt.expectedAutoFormat)
+			}
+
+			app.ReleaseCtx(ctx)
+		})
+	}
+}
+
+func TestCombinedParamsParserFit(t *testing.T) {
+	cfg := &config.Config{
+		AllowAllDimensions: true,
+		Jpeg: config.Jpeg{
+			Quality:    70,
+			Background: "000000",
+		},
+	}
+
+	tests := []struct {
+		name        string
+		query       string
+		expectedFit processing.FitMode
+	}{
+		{name: "fill by default", query: "width=800&height=600", expectedFit: processing.FitFill},
+		{name: "fit", query: "width=800&height=600&fit=fit", expectedFit: processing.FitFit},
+		{name: "pad", query: "width=800&height=600&fit=pad", expectedFit: processing.FitPad},
+		{name: "stretch", query: "width=800&height=600&fit=stretch", expectedFit: processing.FitStretch},
+		{name: "limit", query: "width=800&height=600&fit=limit", expectedFit: processing.FitLimit},
+		{name: "unknown mode falls back to fill", query: "width=800&height=600&fit=zoom", expectedFit: processing.FitFill},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			ctx := app.AcquireCtx(&fasthttp.RequestCtx{})
+			ctx.Request().SetRequestURI("?" + tt.query)
+
+			params := combinedParamsParser(ctx, cfg)
+
+			if params.Fit != tt.expectedFit {
+				t.Errorf("Fit = %v, want %v", params.Fit, tt.expectedFit)
+			}
+
+			app.ReleaseCtx(ctx)
+		})
+	}
+}
+
+func TestCombinedParamsParserGravity(t *testing.T) {
+	cfg := &config.Config{
+		AllowAllDimensions: true,
+		Jpeg: config.Jpeg{
+			Quality:    70,
+			Background: "000000",
+		},
+	}
+
+	tests := []struct {
+		name            string
+		query           string
+		expectedGravity processing.Gravity
+	}{
+		{name: "center by default", query: "width=100&height=100", expectedGravity: processing.Gravity{}},
+		{name: "compass anchor", query: "width=100&height=100&gravity=north", expectedGravity: processing.Gravity{Anchor: imaging.Top}},
+		{name: "focal point", query: "width=100&height=100&gravity=fp:0.3,0.2", expectedGravity: processing.Gravity{Focal: true, X: 0.3, Y: 0.2}},
+		{name: "smart", query: "width=100&height=100&gravity=smart", expectedGravity: processing.Gravity{Smart: true}},
+		{name: "invalid gravity falls back to center", query: "width=100&height=100&gravity=fp:2,2", expectedGravity: processing.Gravity{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			ctx := app.AcquireCtx(&fasthttp.RequestCtx{})
+			ctx.Request().SetRequestURI("?" + tt.query)
+
+			params := combinedParamsParser(ctx, cfg)
+
+			if params.Gravity != tt.expectedGravity {
+				t.Errorf("Gravity = %v, want %v", params.Gravity, tt.expectedGravity)
+			}
+
+			app.ReleaseCtx(ctx)
+		})
+	}
+}
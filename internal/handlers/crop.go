@@ -3,7 +3,9 @@ package handlers
 import (
 	"image"
 
+	"github.com/spossner/img-sizer/internal/cache"
 	"github.com/spossner/img-sizer/internal/config"
+	"github.com/spossner/img-sizer/internal/processing"
 	"github.com/spossner/img-sizer/internal/storage"
 
 	"github.com/gofiber/fiber/v2"
@@ -49,9 +51,11 @@ func cropParamsParser(c *fiber.Ctx, cfg *config.Config) SizerParams {
 		Density: density,
 		Scale:   scale,
 		Crop:    crop,
+		Fit:     processing.FitFill,
+		Format:  processing.FormatJPEG,
 	}
 }
 
-func GetCropHandler(cfg *config.Config, s3Client *storage.S3Client) fiber.Handler {
-	return GetImageSizerHandler(cfg, s3Client, cropParamsParser)
+func GetCropHandler(cfg *config.Config, backends *storage.Backends, httpFetcher *storage.HTTPFetcher, outputCache cache.Cache, pool *processing.Pool, budget *processing.MemoryBudget) fiber.Handler {
+	return GetImageSizerHandler(cfg, backends, httpFetcher, outputCache, pool, budget, cropParamsParser)
 }
@@ -1,12 +1,27 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
 	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
 	"testing"
 
+	"github.com/spossner/img-sizer/internal/cache"
 	"github.com/spossner/img-sizer/internal/config"
+	"github.com/spossner/img-sizer/internal/storage"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/valyala/fasthttp"
 )
 
@@ -261,3 +276,84 @@ func TestCropParamsParserWithAllowAllDimensions(t *testing.T) {
 		})
 	}
 }
+
+// createOrientedJPEG encodes a landscape JPEG and adds an EXIF segment with the given orientation
+func createOrientedJPEG(t *testing.T, width, height int, orientation uint16) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Big endian TIFF header with a single IFD entry for the orientation tag
+	tiff := new(bytes.Buffer)
+	tiff.WriteString("MM")
+	_ = binary.Write(tiff, binary.BigEndian, []uint16{0x002A})
+	_ = binary.Write(tiff, binary.BigEndian, uint32(8))
+	_ = binary.Write(tiff, binary.BigEndian, uint16(1))
+	_ = binary.Write(tiff, binary.BigEndian, []uint16{0x0112, 3})
+	_ = binary.Write(tiff, binary.BigEndian, uint32(1))
+	_ = binary.Write(tiff, binary.BigEndian, []uint16{orientation, 0})
+	_ = binary.Write(tiff, binary.BigEndian, uint32(0))
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	data := buf.Bytes()
+	result := append([]byte{}, data[:2]...)
+	result = append(result, segment...)
+	return append(result, data[2:]...)
+}
+
+func TestCropHandlerOrientedImage(t *testing.T) {
+	// A 400x200 landscape JPEG rotated by its EXIF orientation to a 200x400 portrait
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "rotated.jpg"), createOrientedJPEG(t, 400, 200, 6), 0o644))
+
+	cfg := &config.Config{
+		AllowedSources: []config.SourceConfig{
+			{Pattern: regexp.MustCompile(`^images\.test$`), Backend: config.BackendFS, Root: root},
+		},
+		AllowAllDimensions: true,
+		MaxInputDimension:  5000,
+		MaxOutputDimension: 2000,
+		Jpeg:               config.Jpeg{Quality: 70, Background: "000000"},
+		Logger:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	backends, err := storage.NewBackends(context.Background(), cfg.S3, cfg.AllowedSources)
+	require.NoError(t, err)
+	app := fiber.New()
+	app.Get("/crop.jpg", GetCropHandler(cfg, backends, nil, cache.Nop{}, nil, nil))
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{name: "crop inside the oriented image", query: "x=50&y=250&width=100&height=100", expectedStatus: fiber.StatusOK},
+		{name: "crop only inside the stored image", query: "x=250&y=50&width=100&height=100", expectedStatus: fiber.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest("GET", "/crop.jpg?src=https://images.test/rotated.jpg&"+tt.query, nil))
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedStatus, resp.StatusCode)
+			if tt.expectedStatus != fiber.StatusOK {
+				return
+			}
+
+			img, err := jpeg.Decode(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, image.Pt(100, 100), img.Bounds().Size())
+		})
+	}
+}
@@ -16,14 +16,14 @@ type ServerStatus struct {
 	S3Status  string `json:"s3_status"`
 }
 
-func getStatus(s3Client *storage.S3Client, c *fiber.Ctx, ok, notOk string) (ServerStatus, error) {
+func getStatus(backends *storage.Backends, c *fiber.Ctx, ok, notOk string) (ServerStatus, error) {
 	status := ServerStatus{
 		Status:    ok,
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
 	}
 
-	// Check S3 connectivity
-	err := s3Client.CheckHealth(c.Context())
+	// Check storage connectivity
+	err := backends.CheckHealth(c.Context())
 	if err != nil {
 		status.Status = notOk
 		status.S3Status = fmt.Sprintf("error: %v", err)
@@ -40,16 +40,16 @@ func GetPingHandler() fiber.Handler {
 	}
 }
 
-func GetHealthHandler(cfg *config.Config, s3Client *storage.S3Client) fiber.Handler {
+func GetHealthHandler(cfg *config.Config, backends *storage.Backends) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		status, _ := getStatus(s3Client, c, "healthy", "unhealthy")
+		status, _ := getStatus(backends, c, "healthy", "unhealthy")
 		return c.JSON(status)
 	}
 }
 
-func GetReadinessHandler(cfg *config.Config, s3Client *storage.S3Client) fiber.Handler {
+func GetReadinessHandler(cfg *config.Config, backends *storage.Backends) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		status, err := getStatus(s3Client, c, "ready", "not_ready")
+		status, err := getStatus(backends, c, "ready", "not_ready")
 		if err != nil {
 			c.Status(fiber.StatusServiceUnavailable)
 		}
@@ -0,0 +1,69 @@
+package helpers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/spossner/img-sizer/internal/processing"
+)
+
+// NegotiateFormat picks the acceptable output format with the highest q-value for the given Accept header.
+// Ties are broken in the order WebP, JPEG, PNG.
+// WebP is only chosen when listed explicitly because many clients send wildcards without supporting it.
+// Clients sending no Accept header at all get JPEG.
+func NegotiateFormat(accept string) processing.Format {
+	if strings.TrimSpace(accept) == "" {
+		return processing.FormatJPEG
+	}
+	ranges := parseAccept(accept)
+
+	candidates := []struct {
+		format  processing.Format
+		quality float64
+	}{
+		{format: processing.FormatWebP, quality: ranges["image/webp"]},
+		{format: processing.FormatJPEG, quality: acceptQuality(ranges, "image/jpeg")},
+		{format: processing.FormatPNG, quality: acceptQuality(ranges, "image/png")},
+	}
+	format, best := processing.FormatJPEG, 0.0
+	for _, candidate := range candidates {
+		if candidate.quality > best {
+			format, best = candidate.format, candidate.quality
+		}
+	}
+	return format
+}
+
+// parseAccept returns the q-value of each media range listed in the Accept header
+func parseAccept(accept string) map[string]float64 {
+	ranges := make(map[string]float64)
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if found && strings.TrimSpace(key) == "q" {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = v
+				}
+			}
+		}
+		ranges[mediaType] = q
+	}
+	return ranges
+}
+
+// acceptQuality returns the q-value of the most specific media range matching the media type
+func acceptQuality(ranges map[string]float64, mediaType string) float64 {
+	if q, ok := ranges[mediaType]; ok {
+		return q
+	}
+	if q, ok := ranges["image/*"]; ok {
+		return q
+	}
+	return ranges["*/*"]
+}
@@ -0,0 +1,78 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/spossner/img-sizer/internal/processing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		expected processing.Format
+	}{
+		{
+			name:     "no accept header",
+			accept:   "",
+			expected: processing.FormatJPEG,
+		},
+		{
+			name:     "chrome image request",
+			accept:   "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8",
+			expected: processing.FormatWebP,
+		},
+		{
+			name:     "wildcard only",
+			accept:   "*/*",
+			expected: processing.FormatJPEG,
+		},
+		{
+			name:     "image wildcard only",
+			accept:   "image/*",
+			expected: processing.FormatJPEG,
+		},
+		{
+			name:     "webp explicitly rejected",
+			accept:   "image/webp;q=0, image/*",
+			expected: processing.FormatJPEG,
+		},
+		{
+			name:     "png only",
+			accept:   "image/png",
+			expected: processing.FormatPNG,
+		},
+		{
+			name:     "jpeg preferred over webp",
+			accept:   "image/webp;q=0.1, image/jpeg",
+			expected: processing.FormatJPEG,
+		},
+		{
+			name:     "png preferred over jpeg",
+			accept:   "image/png, image/jpeg;q=0.1",
+			expected: processing.FormatPNG,
+		},
+		{
+			name:     "jpeg rejected",
+			accept:   "image/jpeg;q=0, image/png;q=0.5",
+			expected: processing.FormatPNG,
+		},
+		{
+			name:     "nothing supported",
+			accept:   "image/gif",
+			expected: processing.FormatJPEG,
+		},
+		{
+			name:     "mixed case and whitespace",
+			accept:   " Image/WebP ; q=0.9 , */*;q=0.1",
+			expected: processing.FormatWebP,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, NegotiateFormat(tt.accept))
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package helpers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/disintegration/imaging"
+)
+
+type LoadOptions struct {
+	// AutoOrient applies the EXIF orientation - crop zones refer to the oriented image
+	AutoOrient bool
+	// ValidateDimensions is called with the dimensions from the image header before the full decode
+	ValidateDimensions func(width, height int) error
+	// Admit is called with the dimensions from the image header once they are valid and may block until the image can be decoded
+	Admit func(width, height int) error
+	// MaxBytes limits the size of the encoded source image, 0 means unlimited
+	MaxBytes int64
+}
+
+// DecodeImage decodes the image according to the given options.
+// The dimensions are checked on the header only, so oversized images are rejected before allocating their pixels.
+func DecodeImage(r io.Reader, opts LoadOptions) (image.Image, error) {
+	if opts.MaxBytes > 0 {
+		limited := &limitedReader{r: r, remaining: opts.MaxBytes}
+		img, err := decodeImage(limited, opts)
+		if limited.exceeded {
+			return nil, ErrSourceTooLarge
+		}
+		return img, err
+	}
+	return decodeImage(r, opts)
+}
+
+func decodeImage(r io.Reader, opts LoadOptions) (image.Image, error) {
+	if opts.ValidateDimensions != nil || opts.Admit != nil {
+		// Keep the bytes consumed by reading the header and replay them for the full decode
+		header := new(bytes.Buffer)
+		imgCfg, _, err := image.DecodeConfig(io.TeeReader(r, header))
+		if err != nil {
+			return nil, err
+		}
+		if opts.ValidateDimensions != nil {
+			if err := opts.ValidateDimensions(imgCfg.Width, imgCfg.Height); err != nil {
+				return nil, fmt.Errorf("%w: %dx%d: %v", ErrImageTooLarge, imgCfg.Width, imgCfg.Height, err)
+			}
+		}
+		if opts.Admit != nil {
+			if err := opts.Admit(imgCfg.Width, imgCfg.Height); err != nil {
+				return nil, err
+			}
+		}
+		r = io.MultiReader(header, r)
+	}
+
+	return imaging.Decode(r, imaging.AutoOrientation(opts.AutoOrient))
+}
+
+// checkContentLength rejects sources announcing more bytes than allowed before reading them
+func checkContentLength(contentLength int64, opts LoadOptions) error {
+	if opts.MaxBytes > 0 && contentLength > opts.MaxBytes {
+		return ErrSourceTooLarge
+	}
+	return nil
+}
+
+// limitedReader fails once more than the remaining bytes are read and records that the limit was exceeded
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Probe a single byte to tell a source of exactly the limit from an oversized one
+		n, err := l.r.Read(make([]byte, 1))
+		if n > 0 {
+			l.exceeded = true
+			return 0, ErrSourceTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// decodeError keeps errors the handler reports explicitly and maps everything else to ErrProcessingImage
+func decodeError(err error) error {
+	if errors.Is(err, ErrImageTooLarge) || errors.Is(err, ErrSourceTooLarge) || errors.Is(err, ErrServerBusy) {
+		return err
+	}
+	return ErrProcessingImage
+}
@@ -0,0 +1,228 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createOrientedJPEG encodes a landscape JPEG and adds an EXIF segment with the given orientation
+func createOrientedJPEG(t *testing.T, width, height int, orientation uint16) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Big endian TIFF header with a single IFD entry for the orientation tag
+	tiff := new(bytes.Buffer)
+	tiff.WriteString("MM")
+	_ = binary.Write(tiff, binary.BigEndian, []uint16{0x002A})
+	_ = binary.Write(tiff, binary.BigEndian, uint32(8))
+	_ = binary.Write(tiff, binary.BigEndian, uint16(1))
+	_ = binary.Write(tiff, binary.BigEndian, []uint16{0x0112, 3})
+	_ = binary.Write(tiff, binary.BigEndian, uint32(1))
+	_ = binary.Write(tiff, binary.BigEndian, []uint16{orientation, 0})
+	_ = binary.Write(tiff, binary.BigEndian, uint32(0))
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	data := buf.Bytes()
+	result := append([]byte{}, data[:2]...)
+	result = append(result, segment...)
+	return append(result, data[2:]...)
+}
+
+func TestDecodeImage(t *testing.T) {
+	tests := []struct {
+		name           string
+		orientation    uint16
+		autoOrient     bool
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{
+			name:           "normal orientation",
+			orientation:    1,
+			autoOrient:     true,
+			expectedWidth:  200,
+			expectedHeight: 100,
+		},
+		{
+			name:           "rotated 90 degrees clockwise",
+			orientation:    6,
+			autoOrient:     true,
+			expectedWidth:  100,
+			expectedHeight: 200,
+		},
+		{
+			name:           "rotated 270 degrees clockwise",
+			orientation:    8,
+			autoOrient:     true,
+			expectedWidth:  100,
+			expectedHeight: 200,
+		},
+		{
+			name:           "orientation ignored",
+			orientation:    6,
+			autoOrient:     false,
+			expectedWidth:  200,
+			expectedHeight: 100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := createOrientedJPEG(t, 200, 100, tt.orientation)
+
+			img, err := DecodeImage(bytes.NewReader(data), LoadOptions{AutoOrient: tt.autoOrient})
+			assert.NoError(t, err)
+
+			assert.Equal(t, tt.expectedWidth, img.Bounds().Dx(), "width should match expected")
+			assert.Equal(t, tt.expectedHeight, img.Bounds().Dy(), "height should match expected")
+		})
+	}
+}
+
+func TestDecodeImageInvalidData(t *testing.T) {
+	_, err := DecodeImage(bytes.NewReader([]byte("not an image")), LoadOptions{AutoOrient: true})
+	assert.Error(t, err)
+}
+
+// createPngHeader returns the signature and IHDR chunk of a PNG declaring the given size without any pixel data
+func createPngHeader(width, height uint32) []byte {
+	ihdr := binary.BigEndian.AppendUint32(nil, width)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0) // 8 bit RGBA, default compression, filter and interlace
+
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(ihdr)))
+	chunk = append(chunk, "IHDR"...)
+	chunk = append(chunk, ihdr...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	return append([]byte("\x89PNG\r\n\x1a\n"), chunk...)
+}
+
+func TestDecodeImageValidatesDimensionsBeforeDecoding(t *testing.T) {
+	var gotWidth, gotHeight int
+	opts := LoadOptions{
+		ValidateDimensions: func(width, height int) error {
+			gotWidth, gotHeight = width, height
+			if width*height > 1_000_000 {
+				return errors.New("too many pixels")
+			}
+			return nil
+		},
+	}
+
+	// A header only bomb declaring 60000x60000 pixels must be rejected without decoding
+	_, err := DecodeImage(bytes.NewReader(createPngHeader(60000, 60000)), opts)
+	assert.ErrorIs(t, err, ErrImageTooLarge)
+	assert.Equal(t, 60000, gotWidth)
+	assert.Equal(t, 60000, gotHeight)
+
+	// Valid images are fully decoded after the header check
+	img, err := DecodeImage(bytes.NewReader(createOrientedJPEG(t, 200, 100, 1)), opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, img.Bounds().Dx())
+	assert.Equal(t, 100, img.Bounds().Dy())
+}
+
+func TestDecodeImageAdmit(t *testing.T) {
+	var admitted []int
+	opts := LoadOptions{
+		ValidateDimensions: func(width, height int) error {
+			if width > 1000 {
+				return errors.New("too wide")
+			}
+			return nil
+		},
+		Admit: func(width, height int) error {
+			admitted = append(admitted, width)
+			if width > 500 {
+				return ErrServerBusy
+			}
+			return nil
+		},
+	}
+
+	// Invalid images are rejected before admission
+	_, err := DecodeImage(bytes.NewReader(createPngHeader(2000, 100)), opts)
+	assert.ErrorIs(t, err, ErrImageTooLarge)
+
+	_, err = DecodeImage(bytes.NewReader(createPngHeader(800, 100)), opts)
+	assert.ErrorIs(t, err, ErrServerBusy)
+	assert.ErrorIs(t, decodeError(err), ErrServerBusy, "admission errors are reported explicitly")
+
+	img, err := DecodeImage(bytes.NewReader(createOrientedJPEG(t, 200, 100, 1)), opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, img.Bounds().Dx())
+	assert.Equal(t, []int{800, 200}, admitted)
+}
+
+func TestDecodeImageValidatesStoredDimensionsWithOrientation(t *testing.T) {
+	opts := LoadOptions{
+		AutoOrient: true,
+		ValidateDimensions: func(width, height int) error {
+			return nil
+		},
+	}
+
+	img, err := DecodeImage(bytes.NewReader(createOrientedJPEG(t, 200, 100, 6)), opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, img.Bounds().Dx(), "orientation should still be applied after the header check")
+	assert.Equal(t, 200, img.Bounds().Dy(), "orientation should still be applied after the header check")
+}
+
+func TestDecodeImageMaxBytes(t *testing.T) {
+	data := createOrientedJPEG(t, 200, 100, 1)
+
+	tests := []struct {
+		name     string
+		maxBytes int64
+		wantErr  error
+	}{
+		{name: "unlimited", maxBytes: 0},
+		{name: "exactly the limit", maxBytes: int64(len(data))},
+		{name: "above the limit", maxBytes: int64(len(data)) * 2},
+		{name: "below the limit", maxBytes: int64(len(data)) / 2, wantErr: ErrSourceTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Hide the length of the reader to force the streaming limit
+			reader := io.MultiReader(bytes.NewReader(data))
+			img, err := DecodeImage(reader, LoadOptions{MaxBytes: tt.maxBytes})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, 200, img.Bounds().Dx())
+		})
+	}
+}
+
+func TestCheckContentLength(t *testing.T) {
+	assert.NoError(t, checkContentLength(-1, LoadOptions{MaxBytes: 100}), "unknown length is checked while reading")
+	assert.NoError(t, checkContentLength(100, LoadOptions{MaxBytes: 100}))
+	assert.NoError(t, checkContentLength(1000, LoadOptions{}), "no limit configured")
+	assert.ErrorIs(t, checkContentLength(101, LoadOptions{MaxBytes: 100}), ErrSourceTooLarge)
+}
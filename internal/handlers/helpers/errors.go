@@ -7,4 +7,7 @@ var (
 	ErrLoadingImage    = errors.New("error loading image")
 	ErrURLNotAllowed   = errors.New("URL not allowed")
 	ErrProcessingImage = errors.New("error processing image")
+	ErrImageTooLarge   = errors.New("image dimensions exceed limit")
+	ErrSourceTooLarge  = errors.New("source image too large")
+	ErrServerBusy      = errors.New("server busy")
 )
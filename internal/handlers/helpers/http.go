@@ -4,29 +4,116 @@ import (
 	"context"
 	"image"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/disintegration/imaging"
+	"github.com/spossner/img-sizer/internal/config"
+	"github.com/spossner/img-sizer/internal/storage"
+
 	"github.com/gofiber/fiber/v2"
 )
 
-func LoadImageFromURL(ctx context.Context, url string) (image.Image, error) {
-	resp, err := http.Get(url)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		return nil, ErrLoadingImage
+// HeaderXCache reports whether the response was served from cache
+const (
+	HeaderXCache = "X-Cache"
+	CacheHit     = "HIT"
+	CacheMiss    = "MISS"
+)
+
+// LoadImageFromURL loads and decodes the image from the URL and returns it with the response metadata
+func LoadImageFromURL(ctx context.Context, fetcher *storage.HTTPFetcher, url string, opts LoadOptions) (image.Image, *storage.ObjectInfo, error) {
+	object, err := fetcher.Get(ctx, url)
+	if err != nil {
+		return nil, nil, ErrLoadingImage
+	}
+	defer object.Body.Close()
+
+	if err := checkContentLength(object.ContentLength, opts); err != nil {
+		return nil, nil, err
 	}
-	defer resp.Body.Close()
 
-	img, err := imaging.Decode(resp.Body)
+	img, err := DecodeImage(object.Body, opts)
 	if err != nil {
-		return nil, ErrProcessingImage
+		return nil, nil, decodeError(err)
 	}
-	return img, nil
+	return img, &object.ObjectInfo, nil
 }
 
-func SetResponseHeaders(c *fiber.Ctx, etag string) {
-	c.Set("Content-Type", "image/jpeg")
-	c.Set("ETag", etag)
-	c.Set("Cache-Control", "public, max-age=2592000, immutable")
-	c.Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+// MatchesETag reports whether the If-None-Match header value matches the ETag, weak comparison is used
+func MatchesETag(header, etag string) bool {
+	if header == "" || etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// CacheControl formats the Cache-Control header of a rendered image
+func CacheControl(policy config.CacheControl) string {
+	directives := []string{"public", "max-age=" + seconds(policy.MaxAge)}
+	if policy.SMaxAge > 0 {
+		directives = append(directives, "s-maxage="+seconds(policy.SMaxAge))
+	}
+	if policy.StaleWhileRevalidate > 0 {
+		directives = append(directives, "stale-while-revalidate="+seconds(policy.StaleWhileRevalidate))
+	}
+	if policy.StaleIfError > 0 {
+		directives = append(directives, "stale-if-error="+seconds(policy.StaleIfError))
+	}
+	if policy.Immutable {
+		directives = append(directives, "immutable")
+	}
+	return strings.Join(directives, ", ")
+}
+
+// ErrorCacheControl formats the Cache-Control header of an error response, errors are not stored without TTL
+func ErrorCacheControl(policy config.CacheControl) string {
+	if policy.ErrorMaxAge <= 0 {
+		return "no-store"
+	}
+	return "public, max-age=" + seconds(policy.ErrorMaxAge)
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
+
+// SendError responds with the status and error message cached according to the negative-cache TTL of the policy
+func SendError(c *fiber.Ctx, policy config.CacheControl, status int, message string) error {
+	c.Set(fiber.HeaderCacheControl, ErrorCacheControl(policy))
+	return c.Status(status).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+// SetResponseHeaders sets the headers of a rendered image, Last-Modified is only set if known
+func SetResponseHeaders(c *fiber.Ctx, policy config.CacheControl, contentType, etag string, lastModified time.Time) {
+	c.Set("Content-Type", contentType)
+	if etag != "" {
+		c.Set("ETag", etag)
+	}
+	c.Set("Cache-Control", CacheControl(policy))
+	if !lastModified.IsZero() {
+		c.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// IsNotModified evaluates the conditional request headers against the rendered image.
+// If-None-Match takes precedence over If-Modified-Since.
+func IsNotModified(c *fiber.Ctx, etag string, lastModified time.Time) bool {
+	if match := c.Get(fiber.HeaderIfNoneMatch); match != "" {
+		return MatchesETag(match, etag)
+	}
+	if since := c.Get(fiber.HeaderIfModifiedSince); since != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(since)
+		// HTTP dates have a resolution of seconds
+		return err == nil && !lastModified.Truncate(time.Second).After(t)
+	}
+	return false
 }
@@ -0,0 +1,192 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/spossner/img-sizer/internal/config"
+	"github.com/spossner/img-sizer/internal/storage"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestLoadImageFromURLMaxBytes(t *testing.T) {
+	data := createOrientedJPEG(t, 200, 100, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("chunked") == "" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		} else if f, ok := w.(http.Flusher); ok {
+			// Flushing before writing the body forces chunked transfer encoding without Content-Length
+			w.WriteHeader(http.StatusOK)
+			f.Flush()
+		}
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	fetcher := storage.NewHTTPFetcher(config.HTTPSource{
+		Timeout:         5 * time.Second,
+		MaxRedirects:    5,
+		AllowedNetworks: []*net.IPNet{loopback},
+	}, func(host string) bool { return true })
+
+	tests := []struct {
+		name     string
+		url      string
+		maxBytes int64
+		wantErr  error
+	}{
+		{name: "content length within limit", url: server.URL, maxBytes: int64(len(data))},
+		{name: "content length exceeds limit", url: server.URL, maxBytes: 100, wantErr: ErrSourceTooLarge},
+		{name: "chunked within limit", url: server.URL + "?chunked=1", maxBytes: int64(len(data))},
+		{name: "chunked exceeds limit", url: server.URL + "?chunked=1", maxBytes: 100, wantErr: ErrSourceTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, _, err := LoadImageFromURL(context.Background(), fetcher, tt.url, LoadOptions{MaxBytes: tt.maxBytes})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, 200, img.Bounds().Dx())
+		})
+	}
+}
+
+func TestMatchesETag(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		etag     string
+		expected bool
+	}{
+		{name: "exact match", header: `"abc"`, etag: `"abc"`, expected: true},
+		{name: "no match", header: `"def"`, etag: `"abc"`, expected: false},
+		{name: "empty header", header: "", etag: `"abc"`, expected: false},
+		{name: "empty etag", header: `"abc"`, etag: "", expected: false},
+		{name: "list", header: `"def", "abc"`, etag: `"abc"`, expected: true},
+		{name: "weak validator", header: `W/"abc"`, etag: `"abc"`, expected: true},
+		{name: "wildcard", header: "*", etag: `"abc"`, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, MatchesETag(tt.header, tt.etag))
+		})
+	}
+}
+
+func TestIsNotModified(t *testing.T) {
+	lastModified := time.Date(2025, 3, 1, 12, 0, 0, 500_000_000, time.UTC)
+
+	tests := []struct {
+		name            string
+		ifNoneMatch     string
+		ifModifiedSince string
+		etag            string
+		lastModified    time.Time
+		expected        bool
+	}{
+		{name: "no conditions", etag: `"abc"`, lastModified: lastModified, expected: false},
+		{name: "matching etag", ifNoneMatch: `"abc"`, etag: `"abc"`, expected: true},
+		{name: "different etag", ifNoneMatch: `"def"`, etag: `"abc"`, expected: false},
+		{name: "not modified since", ifModifiedSince: "Sat, 01 Mar 2025 12:00:00 GMT", lastModified: lastModified, expected: true},
+		{name: "modified since", ifModifiedSince: "Sat, 01 Mar 2025 11:59:59 GMT", lastModified: lastModified, expected: false},
+		{name: "unknown modification time", ifModifiedSince: "Sat, 01 Mar 2025 12:00:00 GMT", expected: false},
+		{name: "invalid date", ifModifiedSince: "yesterday", lastModified: lastModified, expected: false},
+		{
+			name:            "etag takes precedence",
+			ifNoneMatch:     `"def"`,
+			ifModifiedSince: "Sat, 01 Mar 2025 12:00:00 GMT",
+			etag:            `"abc"`,
+			lastModified:    lastModified,
+			expected:        false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			ctx := app.AcquireCtx(&fasthttp.RequestCtx{})
+			defer app.ReleaseCtx(ctx)
+			if tt.ifNoneMatch != "" {
+				ctx.Request().Header.Set(fiber.HeaderIfNoneMatch, tt.ifNoneMatch)
+			}
+			if tt.ifModifiedSince != "" {
+				ctx.Request().Header.Set(fiber.HeaderIfModifiedSince, tt.ifModifiedSince)
+			}
+
+			assert.Equal(t, tt.expected, IsNotModified(ctx, tt.etag, tt.lastModified))
+		})
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   config.CacheControl
+		expected string
+		errors   string
+	}{
+		{name: "empty policy", expected: "public, max-age=0", errors: "no-store"},
+		{
+			name:     "immutable",
+			policy:   config.CacheControl{MaxAge: 30 * 24 * time.Hour, Immutable: true, ErrorMaxAge: time.Minute},
+			expected: "public, max-age=2592000, immutable",
+			errors:   "public, max-age=60",
+		},
+		{
+			name: "all directives",
+			policy: config.CacheControl{
+				MaxAge:               time.Hour,
+				SMaxAge:              24 * time.Hour,
+				StaleWhileRevalidate: time.Minute,
+				StaleIfError:         12 * time.Hour,
+				Immutable:            true,
+				ErrorMaxAge:          10 * time.Second,
+			},
+			expected: "public, max-age=3600, s-maxage=86400, stale-while-revalidate=60, stale-if-error=43200, immutable",
+			errors:   "public, max-age=10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, CacheControl(tt.policy))
+			assert.Equal(t, tt.errors, ErrorCacheControl(tt.policy))
+		})
+	}
+}
+
+func TestCacheControlPolicy(t *testing.T) {
+	var cfg config.Config
+	cfg.CacheControl = config.CacheControl{MaxAge: time.Hour, Immutable: true, ErrorMaxAge: time.Minute}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"route_cache_control": {"/resize.jpg": {"max_age": "10m", "stale_if_error": "1h"}},
+		"cache_control": {"s_maxage": "24h"}
+	}`), &cfg))
+
+	// Durations not given keep their defaults
+	assert.Equal(t, config.CacheControl{MaxAge: time.Hour, SMaxAge: 24 * time.Hour, Immutable: true, ErrorMaxAge: time.Minute}, cfg.CacheControl)
+	assert.Equal(t, cfg.CacheControl, cfg.CacheControlPolicy("/v2/resize.jpg", nil))
+	assert.Equal(t, config.CacheControl{MaxAge: 10 * time.Minute, StaleIfError: time.Hour}, cfg.CacheControlPolicy("/resize.jpg", nil))
+
+	source := &config.SourceConfig{CacheControl: &config.CacheControl{MaxAge: time.Minute}}
+	assert.Equal(t, *source.CacheControl, cfg.CacheControlPolicy("/resize.jpg", source))
+	assert.Equal(t, cfg.CacheControl, cfg.CacheControlPolicy("/v2/resize.jpg", &config.SourceConfig{}))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"cache_control": {"max_age": "forever"}}`), &cfg))
+}
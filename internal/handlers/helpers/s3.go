@@ -8,49 +8,54 @@ import (
 
 	"github.com/spossner/img-sizer/internal/config"
 	"github.com/spossner/img-sizer/internal/storage"
-
-	"github.com/disintegration/imaging"
 )
 
-// ParseS3Url parses the S3 URL and returns the bucket name and key or an error if the URL is invalid or not configured
-func ParseS3Url(cfg *config.Config, sourceURL string) (string, string, error) {
+// ParseS3Url parses the S3 URL and returns the matching source config, the bucket name and key or an error if the URL is invalid or not configured
+func ParseS3Url(cfg *config.Config, sourceURL string) (*config.SourceConfig, string, string, error) {
 	parsedURL, err := url.Parse(sourceURL)
 	if err != nil {
-		return "", "", ErrInvalidURL
+		return nil, "", "", ErrInvalidURL
 	}
 
 	// The key is the path without the leading slash
 	key := strings.TrimPrefix(parsedURL.Path, "/")
 
 	// Find the bucket name from pattern
-	for _, source := range cfg.AllowedSources {
-		if source.Pattern.MatchString(parsedURL.Host) {
+	for i := range cfg.AllowedSources {
+		source := &cfg.AllowedSources[i]
+		if source.MatchesHost(parsedURL.Host) {
 			if source.Matcher != nil {
 				matches := source.Matcher.FindStringSubmatch(sourceURL)
 				if len(matches) == 3 {
-					return matches[1], matches[2], nil
+					return source, matches[1], matches[2], nil
 				}
-				return "", "", ErrInvalidURL
+				return nil, "", "", ErrInvalidURL
 			}
-			return source.Bucket, key, nil
+			return source, source.Bucket, key, nil
 		}
 	}
 
-	return "", "", ErrURLNotAllowed
+	return nil, "", "", ErrURLNotAllowed
 }
 
-func LoadImageFromS3(ctx context.Context, s3Client *storage.S3Client, bucket, key string) (image.Image, error) {
-	// Download image from S3
-	reader, err := s3Client.GetObject(ctx, bucket, key)
+// LoadImageFromStorage loads and decodes the image from the storage backend and returns it with the object metadata
+func LoadImageFromStorage(ctx context.Context, backend storage.Backend, bucket, key string, opts LoadOptions) (image.Image, *storage.ObjectInfo, error) {
+	// Download image from storage
+	object, err := backend.GetObject(ctx, bucket, key)
 	if err != nil {
-		return nil, ErrLoadingImage
+		return nil, nil, ErrLoadingImage
+	}
+	defer object.Body.Close()
+
+	if err := checkContentLength(object.ContentLength, opts); err != nil {
+		return nil, nil, err
 	}
-	defer reader.Close()
 
 	// Decode image
-	img, err := imaging.Decode(reader)
+	img, err := DecodeImage(object.Body, opts)
 	if err != nil {
-		return nil, ErrProcessingImage
+		return nil, nil, decodeError(err)
 	}
-	return img, nil
+
+	return img, &object.ObjectInfo, nil
 }
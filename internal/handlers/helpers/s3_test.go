@@ -1,13 +1,21 @@
 package helpers
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/spossner/img-sizer/internal/config"
+	"github.com/spossner/img-sizer/internal/storage"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParseS3Url(t *testing.T) {
@@ -95,6 +103,32 @@ func TestParseS3Url(t *testing.T) {
 			urlToParse:  "https://other-domain.com/images/test.jpg",
 			expectError: true,
 		},
+		{
+			name: "host only starting with pattern",
+			configContent: `{
+				"allowed_sources": [
+					{
+						"pattern": "images.example.com"
+					}
+				]
+			}`,
+			urlToParse:  "https://images.example.com.attacker.net/x.jpg",
+			expectError: true,
+		},
+		{
+			name: "host with port",
+			configContent: `{
+				"allowed_sources": [
+					{
+						"pattern": "images.example.com"
+					}
+				]
+			}`,
+			urlToParse:     "https://images.example.com:8443/x.jpg",
+			expectedBucket: "",
+			expectedKey:    "x.jpg",
+			expectError:    false,
+		},
 		{
 			name: "invalid URL",
 			configContent: `{
@@ -148,6 +182,22 @@ func TestParseS3Url(t *testing.T) {
 			expectedKey:    "images/test.jpg",
 			expectError:    false,
 		},
+		{
+			name: "filesystem backend",
+			configContent: `{
+				"allowed_sources": [
+					{
+						"pattern": "static.nebenan.de",
+						"backend": "fs",
+						"root": "/data/images"
+					}
+				]
+			}`,
+			urlToParse:     "https://static.nebenan.de/images/test.jpg",
+			expectedBucket: "",
+			expectedKey:    "images/test.jpg",
+			expectError:    false,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -174,7 +224,7 @@ func TestParseS3Url(t *testing.T) {
 			}
 
 			// Parse URL
-			bucket, key, err := ParseS3Url(cfg, tc.urlToParse)
+			source, bucket, key, err := ParseS3Url(cfg, tc.urlToParse)
 
 			// Check error
 			if tc.expectError {
@@ -182,6 +232,7 @@ func TestParseS3Url(t *testing.T) {
 				return
 			}
 			assert.NoError(t, err)
+			assert.NotNil(t, source)
 
 			// Check results
 			assert.Equal(t, tc.expectedBucket, bucket)
@@ -189,3 +240,65 @@ func TestParseS3Url(t *testing.T) {
 		})
 	}
 }
+
+func TestSourceConfigInvalidBackend(t *testing.T) {
+	for _, source := range []string{
+		`{"pattern": "static.nebenan.de", "backend": "ftp"}`,
+		`{"pattern": "static.nebenan.de", "backend": "fs"}`,
+	} {
+		var cfg config.SourceConfig
+		assert.Error(t, cfg.UnmarshalJSON([]byte(source)), source)
+	}
+}
+
+func TestIsAllowedHost(t *testing.T) {
+	var cfg config.Config
+	require.NoError(t, json.Unmarshal([]byte(`{"allowed_sources": [
+		{"pattern": "images.example.com", "bucket": "images"},
+		{"pattern": "*.cdn.example.com"}
+	]}`), &cfg))
+
+	tests := []struct {
+		host     string
+		expected bool
+	}{
+		{host: "images.example.com", expected: true},
+		{host: "images.example.com:8080", expected: true},
+		{host: "IMAGES.example.com", expected: true},
+		{host: "eu.cdn.example.com", expected: true},
+		{host: "eu.cdn.example.com:443", expected: true},
+		{host: "images.example.com.attacker.net", expected: false},
+		{host: "images.example.comattacker.net", expected: false},
+		{host: "eu.cdn.example.com.attacker.net:443", expected: false},
+		{host: "cdn.example.com", expected: false},
+		{host: "attacker.net", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			assert.Equal(t, tt.expected, cfg.IsAllowedHost(tt.host))
+		})
+	}
+}
+
+func TestLoadImageFromStorage(t *testing.T) {
+	dir := t.TempDir()
+	buf := new(bytes.Buffer)
+	require.NoError(t, png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 40, 30))))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "images"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "images", "test.png"), buf.Bytes(), 0o644))
+
+	backend, err := storage.NewFSBackend(dir)
+	require.NoError(t, err)
+
+	img, info, err := LoadImageFromStorage(context.Background(), backend, "", "images/test.png", LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, image.Pt(40, 30), img.Bounds().Size())
+	assert.NotEmpty(t, info.ETag, "object metadata should be returned")
+
+	_, _, err = LoadImageFromStorage(context.Background(), backend, "", "images/missing.png", LoadOptions{})
+	assert.ErrorIs(t, err, ErrLoadingImage)
+
+	_, _, err = LoadImageFromStorage(context.Background(), backend, "", "images/test.png", LoadOptions{MaxBytes: 10})
+	assert.ErrorIs(t, err, ErrSourceTooLarge)
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"github.com/spossner/img-sizer/internal/processing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ProcessingMetrics struct {
+	InUse        int                    `json:"in_use"`
+	Queued       int                    `json:"queued"`
+	MemoryBudget processing.BudgetStats `json:"memory_budget"`
+}
+
+// GetMetricsHandler reports the usage of the processing pool and the memory budget
+func GetMetricsHandler(pool *processing.Pool, budget *processing.MemoryBudget) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(ProcessingMetrics{
+			InUse:        pool.InUse(),
+			Queued:       pool.Queued(),
+			MemoryBudget: budget.Stats(),
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spossner/img-sizer/internal/processing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	pool := processing.NewPool(2, 10, time.Second)
+	budget := processing.NewMemoryBudget(1000, time.Second)
+	releaseSlot, err := pool.Acquire(context.Background())
+	require.NoError(t, err)
+	defer releaseSlot()
+	releaseMemory, err := budget.Reserve(context.Background(), 400)
+	require.NoError(t, err)
+	defer releaseMemory()
+
+	app := fiber.New()
+	app.Get("/metrics", GetMetricsHandler(pool, budget))
+	resp, err := app.Test(httptest.NewRequest("GET", "/metrics", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var metrics ProcessingMetrics
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&metrics))
+	assert.Equal(t, 1, metrics.InUse)
+	assert.Equal(t, int64(1000), metrics.MemoryBudget.LimitBytes)
+	assert.Equal(t, int64(400), metrics.MemoryBudget.UsedBytes)
+	assert.Equal(t, int64(1), metrics.MemoryBudget.Admitted)
+}
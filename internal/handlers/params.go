@@ -5,22 +5,41 @@ import (
 	"image"
 
 	"github.com/spossner/img-sizer/internal/config"
+	"github.com/spossner/img-sizer/internal/processing"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type SizerParams struct {
-	Width   int
-	Height  int
-	Quality int
-	BgColor string
-	Density float64
-	Scale   float64
-	Crop    image.Rectangle
+	Width    int
+	Height   int
+	Quality  int
+	BgColor  string
+	Density  float64
+	Scale    float64
+	Crop     image.Rectangle
+	Fit      processing.FitMode
+	Gravity  processing.Gravity
+	Format   processing.Format
+	Lossless bool
+	// AutoFormat marks a format negotiated from the Accept header
+	AutoFormat bool
 }
 
 func (p SizerParams) String() string {
-	return fmt.Sprintf("%dx%d-q%d-bg%s-d%.2f-s%.2f-c%v", p.Width, p.Height, p.Quality, p.BgColor, p.Density, p.Scale, p.Crop)
+	s := fmt.Sprintf("%dx%d-q%d-bg%s-d%.2f-s%.2f-c%v-m%s-g%s-f%s", p.Width, p.Height, p.Quality, p.BgColor, p.Density, p.Scale, p.Crop, p.Fit, p.Gravity, p.Format)
+	if p.Lossless {
+		s += "-lossless"
+	}
+	return s
+}
+
+// defaultQuality returns the configured encoder quality for the given output format
+func defaultQuality(cfg *config.Config, format processing.Format) int {
+	if format == processing.FormatWebP {
+		return cfg.Webp.Quality
+	}
+	return cfg.Jpeg.Quality
 }
 
 type ParamsParser func(c *fiber.Ctx, cfg *config.Config) SizerParams
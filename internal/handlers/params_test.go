@@ -4,6 +4,7 @@ import (
 	"image"
 	"testing"
 
+	"github.com/spossner/img-sizer/internal/processing"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -23,8 +24,10 @@ func TestSizerParamsString(t *testing.T) {
 				Density: 1.0,
 				Scale:   1.0,
 				Crop:    image.Rectangle{},
+				Fit:     processing.FitFill,
+				Format:  processing.FormatJPEG,
 			},
-			expected: "100x200-q80-bg000000-d1.00-s1.00-c(0,0)-(0,0)",
+			expected: "100x200-q80-bg000000-d1.00-s1.00-c(0,0)-(0,0)-mfill-gcenter-fjpeg",
 		},
 		{
 			name: "with crop rectangle",
@@ -36,8 +39,10 @@ func TestSizerParamsString(t *testing.T) {
 				Density: 2.0,
 				Scale:   0.5,
 				Crop:    image.Rect(10, 20, 810, 620),
+				Fit:     processing.FitFill,
+				Format:  processing.FormatWebP,
 			},
-			expected: "800x600-q90-bgFFFFFF-d2.00-s0.50-c(10,20)-(810,620)",
+			expected: "800x600-q90-bgFFFFFF-d2.00-s0.50-c(10,20)-(810,620)-mfill-gcenter-fwebp",
 		},
 		{
 			name: "zero values",
@@ -50,7 +55,7 @@ func TestSizerParamsString(t *testing.T) {
 				Scale:   0.0,
 				Crop:    image.Rectangle{},
 			},
-			expected: "0x0-q0-bg-d0.00-s0.00-c(0,0)-(0,0)",
+			expected: "0x0-q0-bg-d0.00-s0.00-c(0,0)-(0,0)-m-gcenter-f",
 		},
 		{
 			name: "negative values",
@@ -62,8 +67,10 @@ func TestSizerParamsString(t *testing.T) {
 				Density: 1.5,
 				Scale:   0.75,
 				Crop:    image.Rect(-10, -20, 90, 180),
+				Fit:     processing.FitFill,
+				Format:  processing.FormatJPEG,
 			},
-			expected: "-100x-200-q70-bgFF0000-d1.50-s0.75-c(-10,-20)-(90,180)",
+			expected: "-100x-200-q70-bgFF0000-d1.50-s0.75-c(-10,-20)-(90,180)-mfill-gcenter-fjpeg",
 		},
 		{
 			name: "decimal values",
@@ -75,8 +82,26 @@ func TestSizerParamsString(t *testing.T) {
 				Density: 1.25,
 				Scale:   0.333,
 				Crop:    image.Rect(0, 0, 1024, 768),
+				Fit:     processing.FitFill,
+				Format:  processing.FormatPNG,
 			},
-			expected: "1024x768-q85-bg808080-d1.25-s0.33-c(0,0)-(1024,768)",
+			expected: "1024x768-q85-bg808080-d1.25-s0.33-c(0,0)-(1024,768)-mfill-gcenter-fpng",
+		},
+		{
+			name: "lossless webp",
+			params: SizerParams{
+				Width:    100,
+				Height:   100,
+				Quality:  75,
+				BgColor:  "000000",
+				Density:  1.0,
+				Scale:    1.0,
+				Crop:     image.Rectangle{},
+				Fit:      processing.FitFill,
+				Format:   processing.FormatWebP,
+				Lossless: true,
+			},
+			expected: "100x100-q75-bg000000-d1.00-s1.00-c(0,0)-(0,0)-mfill-gcenter-fwebp-lossless",
 		},
 	}
 
@@ -123,4 +148,22 @@ func TestSizerParamsEquality(t *testing.T) {
 	}
 
 	assert.NotEqual(t, params1.String(), params3.String(), "Different SizerParams should have different string representations")
+
+	// Test with different output format
+	params4 := params1
+	params4.Format = processing.FormatWebP
+
+	assert.NotEqual(t, params1.String(), params4.String(), "Different output formats should have different string representations")
+
+	// Test with different fit mode
+	params5 := params1
+	params5.Fit = processing.FitPad
+
+	assert.NotEqual(t, params1.String(), params5.String(), "Different fit modes should have different string representations")
+
+	// Test with different gravity
+	params6 := params1
+	params6.Gravity = processing.Gravity{Focal: true, X: 0.3, Y: 0.2}
+
+	assert.NotEqual(t, params1.String(), params6.String(), "Different gravities should have different string representations")
 }
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"github.com/spossner/img-sizer/internal/cache"
+	"github.com/spossner/img-sizer/internal/config"
+	"github.com/spossner/img-sizer/internal/processing"
+	"github.com/spossner/img-sizer/internal/storage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func pngParamsParser(c *fiber.Ctx, cfg *config.Config) SizerParams {
+	// PNG shares the combined cropping and resizing parameters
+	params := combinedParamsParser(c, cfg)
+
+	params.Format = processing.FormatPNG
+	params.Lossless = false
+	params.AutoFormat = false
+	// Keep transparency unless a background is given explicitly
+	params.BgColor = c.Query("background")
+
+	return params
+}
+
+func GetPngHandler(cfg *config.Config, backends *storage.Backends, httpFetcher *storage.HTTPFetcher, outputCache cache.Cache, pool *processing.Pool, budget *processing.MemoryBudget) fiber.Handler {
+	return GetImageSizerHandler(cfg, backends, httpFetcher, outputCache, pool, budget, pngParamsParser)
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"image"
+	"testing"
+
+	"github.com/spossner/img-sizer/internal/config"
+	"github.com/spossner/img-sizer/internal/processing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+func TestPngParamsParser(t *testing.T) {
+	// Create test config
+	cfg := &config.Config{
+		MaxInputDimension:  5000,
+		MaxOutputDimension: 2000,
+		AllowAllDimensions: true,
+		Jpeg: config.Jpeg{
+			Quality:    70,
+			Background: "000000",
+		},
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedParams SizerParams
+	}{
+		{
+			name:  "keeps transparency by default",
+			query: "width=800&height=600",
+			expectedParams: SizerParams{
+				Width:   800,
+				Height:  600,
+				Quality: 70,
+				BgColor: "",
+				Density: 1.0,
+				Scale:   1.0,
+				Crop:    image.Rectangle{},
+				Fit:     processing.FitFill,
+				Format:  processing.FormatPNG,
+			},
+		},
+		{
+			name:  "explicit background",
+			query: "width=800&height=600&background=FFFFFF",
+			expectedParams: SizerParams{
+				Width:   800,
+				Height:  600,
+				Quality: 70,
+				BgColor: "FFFFFF",
+				Density: 1.0,
+				Scale:   1.0,
+				Crop:    image.Rectangle{},
+				Fit:     processing.FitFill,
+				Format:  processing.FormatPNG,
+			},
+		},
+		{
+			name:  "format parameter is ignored",
+			query: "width=800&height=600&format=auto&lossless=true",
+			expectedParams: SizerParams{
+				Width:   800,
+				Height:  600,
+				Quality: 70,
+				BgColor: "",
+				Density: 1.0,
+				Scale:   1.0,
+				Crop:    image.Rectangle{},
+				Fit:     processing.FitFill,
+				Format:  processing.FormatPNG,
+			},
+		},
+		{
+			name:  "with crop and density",
+			query: "width=100&height=100&crop[x]=10&crop[y]=20&crop[width]=200&crop[height]=200&density=2.0",
+			expectedParams: SizerParams{
+				Width:   200,
+				Height:  200,
+				Quality: 70,
+				BgColor: "",
+				Density: 2.0,
+				Scale:   1.0,
+				Crop:    image.Rect(10, 20, 210, 220),
+				Fit:     processing.FitFill,
+				Format:  processing.FormatPNG,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			ctx := app.AcquireCtx(&fasthttp.RequestCtx{})
+			ctx.Request().SetRequestURI("?" + tt.query)
+
+			params := pngParamsParser(ctx, cfg)
+
+			if params != tt.expectedParams {
+				t.Errorf("pngParamsParser() = %+v, want %+v", params, tt.expectedParams)
+			}
+
+			app.ReleaseCtx(ctx)
+		})
+	}
+}
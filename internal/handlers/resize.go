@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"github.com/spossner/img-sizer/internal/cache"
 	"github.com/spossner/img-sizer/internal/config"
+	"github.com/spossner/img-sizer/internal/processing"
 	"github.com/spossner/img-sizer/internal/storage"
 
 	"github.com/gofiber/fiber/v2"
@@ -31,9 +33,11 @@ func resizeParamsParser(c *fiber.Ctx, cfg *config.Config) SizerParams {
 		Quality: quality,
 		BgColor: bgColor,
 		Density: density,
+		Fit:     processing.FitFill,
+		Format:  processing.FormatJPEG,
 	}
 }
 
-func GetResizeHandler(cfg *config.Config, s3Client *storage.S3Client) fiber.Handler {
-	return GetImageSizerHandler(cfg, s3Client, resizeParamsParser)
+func GetResizeHandler(cfg *config.Config, backends *storage.Backends, httpFetcher *storage.HTTPFetcher, outputCache cache.Cache, pool *processing.Pool, budget *processing.MemoryBudget) fiber.Handler {
+	return GetImageSizerHandler(cfg, backends, httpFetcher, outputCache, pool, budget, resizeParamsParser)
 }
@@ -2,10 +2,15 @@ package handlers
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"image"
-	"image/jpeg"
+	"math"
 	"net/http"
+	"strconv"
 
+	"github.com/spossner/img-sizer/internal/cache"
 	"github.com/spossner/img-sizer/internal/config"
 	"github.com/spossner/img-sizer/internal/handlers/helpers"
 	"github.com/spossner/img-sizer/internal/processing"
@@ -15,109 +20,253 @@ import (
 
 	"github.com/disintegration/imaging"
 	"github.com/gofiber/fiber/v2"
+	"golang.org/x/sync/singleflight"
 )
 
-func GetImageSizerHandler(cfg *config.Config, s3Client *storage.S3Client, paramsParser ParamsParser) fiber.Handler {
+func GetImageSizerHandler(cfg *config.Config, backends *storage.Backends, httpFetcher *storage.HTTPFetcher, outputCache cache.Cache, pool *processing.Pool, budget *processing.MemoryBudget, paramsParser ParamsParser) fiber.Handler {
+	// Concurrent requests for the same rendering wait for one render and share its result
+	var renders singleflight.Group
+
 	return func(c *fiber.Ctx) error {
 		params := paramsParser(c, cfg)
 		if !validators.IsAllowedDimension(cfg, params.Width, params.Height) {
 			cfg.Logger.Error("invalid dimensions", "width", params.Width, "height", params.Height)
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "invalid dimensions",
-			})
+			return helpers.SendError(c, cfg.CacheControlPolicy(c.Route().Path, nil), fiber.StatusBadRequest, "invalid dimensions")
 		}
 
 		if err := validators.ValidateOutputDimensions(cfg, params.Width, params.Height); err != nil {
 			cfg.Logger.Error("requested output dimensions exceed limit", "width", params.Width, "height", params.Height)
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "requested output dimensions exceed limit",
-			})
+			return helpers.SendError(c, cfg.CacheControlPolicy(c.Route().Path, nil), fiber.StatusBadRequest, "requested output dimensions exceed limit")
 		}
 
 		sourceURL := c.Query("src")
 		if sourceURL == "" {
 			cfg.Logger.Error("source URL is required")
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "source URL is required",
-			})
+			return helpers.SendError(c, cfg.CacheControlPolicy(c.Route().Path, nil), fiber.StatusBadRequest, "source URL is required")
 		}
 
-		bucket, key, err := helpers.ParseS3Url(cfg, sourceURL)
+		source, bucket, key, err := helpers.ParseS3Url(cfg, sourceURL)
 		if err != nil {
 			cfg.Logger.Error("invalid source URL", "error", err)
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "invalid source URL",
-			})
+			return helpers.SendError(c, cfg.CacheControlPolicy(c.Route().Path, nil), fiber.StatusBadRequest, "invalid source URL")
+		}
+		policy := cfg.CacheControlPolicy(c.Route().Path, source)
+
+		// Serve the rendered image from cache if available
+		cacheKey := cache.Key(sourceURL, params.String())
+		if entry, ok := outputCache.Get(c.Context(), cacheKey); ok {
+			c.Set(helpers.HeaderXCache, helpers.CacheHit)
+			return sendEntry(c, policy, entry, params)
 		}
+		c.Set(helpers.HeaderXCache, helpers.CacheMiss)
 
-		var img image.Image
-		if bucket != "" { // load from s3 if bucket is configured
-			img, err = helpers.LoadImageFromS3(c.Context(), s3Client, bucket, key)
+		// Answer conditional requests from the source metadata without rendering
+		if c.Get(fiber.HeaderIfNoneMatch) != "" || c.Get(fiber.HeaderIfModifiedSince) != "" {
+			if info := headSource(c.Context(), backends, httpFetcher, source, bucket, key, sourceURL); info != nil {
+				entry := &cache.Entry{
+					ContentType:  params.Format.ContentType(),
+					ETag:         sourceETag(sourceURL, info, params),
+					LastModified: info.LastModified,
+				}
+				if helpers.IsNotModified(c, entry.ETag, entry.LastModified) {
+					return sendEntry(c, policy, entry, params)
+				}
+			}
+		}
+
+		result, err, shared := renders.Do(cacheKey, func() (any, error) {
+			// Wait for a processing slot to keep the number of decoded images in memory bounded
+			release, err := pool.Acquire(c.Context())
 			if err != nil {
-				cfg.Logger.Error("error loading image from S3", "bucket", bucket, "key", key, "error", err)
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error": "error processing image",
-				})
+				cfg.Logger.Warn("rejected rendering", "url", sourceURL, "in_use", pool.InUse(), "queued", pool.Queued(), "error", err)
+				return nil, &renderError{status: fiber.StatusServiceUnavailable, message: "server busy"}
 			}
-		} else {
-			cfg.Logger.Warn("unmapped source URL - loading from URL", "url", sourceURL)
-			img, err = helpers.LoadImageFromURL(c.Context(), sourceURL)
+			defer release()
+
+			entry, err := renderImage(c.Context(), cfg, backends, httpFetcher, budget, source, bucket, key, sourceURL, params)
 			if err != nil {
-				cfg.Logger.Error("error loading image from URL", "url", sourceURL, "error", err)
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error": "error processing image",
-				})
+				return nil, err
 			}
+			outputCache.Set(c.Context(), cacheKey, entry)
+			return entry, nil
+		})
+		if shared {
+			cfg.Logger.Debug("shared rendering with concurrent requests", "url", sourceURL, "params", params.String())
 		}
+		if err != nil {
+			var renderErr *renderError
+			if !errors.As(err, &renderErr) {
+				renderErr = &renderError{status: fiber.StatusInternalServerError, message: "error processing image"}
+			}
+			if renderErr.status == fiber.StatusServiceUnavailable {
+				// Overload is temporary, so the response must not be cached
+				c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(cfg.Processing.RetryAfter.Seconds()))))
+				return helpers.SendError(c, config.CacheControl{}, renderErr.status, renderErr.message)
+			}
+			return helpers.SendError(c, policy, renderErr.status, renderErr.message)
+		}
+		return sendEntry(c, policy, result.(*cache.Entry), params)
+	}
+}
 
-		if err = validators.ValidateInputDimensions(cfg, img.Bounds().Size().X, img.Bounds().Size().Y); err != nil {
-			cfg.Logger.Error("image dimensions exceed limit", "bucket", bucket, "key", key, "width", img.Bounds().Size().X, "height", img.Bounds().Size().Y)
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "image dimensions exceed limit",
-			})
+// renderError is a failed rendering answered with the status and message
+type renderError struct {
+	status  int
+	message string
+}
+
+func (e *renderError) Error() string {
+	return e.message
+}
+
+// renderImage loads the source image and renders it according to the params
+func renderImage(ctx context.Context, cfg *config.Config, backends *storage.Backends, httpFetcher *storage.HTTPFetcher, budget *processing.MemoryBudget, source *config.SourceConfig, bucket, key, sourceURL string, params SizerParams) (*cache.Entry, error) {
+	loadOpts := helpers.LoadOptions{
+		// Apply the EXIF orientation unless disabled for the source - crop zones refer to the oriented image
+		AutoOrient: !source.IgnoreExifOrientation,
+		// Reject oversized images based on their header before decoding the pixels
+		ValidateDimensions: func(width, height int) error {
+			return validators.ValidateInputDimensions(cfg, width, height)
+		},
+		MaxBytes: cfg.MaxSourceBytes,
+	}
+	// Wait until the decoded image fits into the memory budget, it is released once the image is encoded
+	release := func() {}
+	defer func() { release() }()
+	loadOpts.Admit = func(width, height int) error {
+		reserved, err := budget.Reserve(ctx, processing.EstimateDecodeBytes(width, height))
+		if errors.Is(err, processing.ErrExceedsBudget) {
+			return fmt.Errorf("%w: %v", helpers.ErrImageTooLarge, err)
+		}
+		if err != nil {
+			cfg.Logger.Warn("rejected decoding", "width", width, "height", height, "error", err)
+			return fmt.Errorf("%w: %v", helpers.ErrServerBusy, err)
 		}
+		release = reserved
+		return nil
+	}
+	if source.MaxSourceBytes > 0 {
+		loadOpts.MaxBytes = source.MaxSourceBytes
+	}
 
-		if params.Crop.Dx() > 0 && params.Crop.Dy() > 0 {
-			if err = validators.ValidateCropZone(cfg, img.Bounds().Size().X, img.Bounds().Size().Y, params.Crop); err != nil {
-				cfg.Logger.Error("invalid crop zone", "bounds", img.Bounds().Size(), "crop", params.Crop)
-				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-					"error": "invalid crop zone",
-				})
-			}
-			// Crop image
-			img = imaging.Crop(img, params.Crop)
+	var img image.Image
+	var info *storage.ObjectInfo
+	var err error
+	if backend := backends.For(source, bucket); backend != nil { // load from storage if the source is mapped
+		img, info, err = helpers.LoadImageFromStorage(ctx, backend, bucket, key, loadOpts)
+		if err != nil {
+			cfg.Logger.Error("error loading image from storage", "bucket", bucket, "key", key, "error", err)
+			return nil, loadError(err)
 		}
+	} else {
+		cfg.Logger.Warn("unmapped source URL - loading from URL", "url", sourceURL)
+		img, info, err = helpers.LoadImageFromURL(ctx, httpFetcher, sourceURL, loadOpts)
+		if err != nil {
+			cfg.Logger.Error("error loading image from URL", "url", sourceURL, "error", err)
+			return nil, loadError(err)
+		}
+	}
 
-		// Resize image
-		img = processing.ResizeImage(img, params.Width, params.Height)
+	if params.Crop.Dx() > 0 && params.Crop.Dy() > 0 {
+		if err = validators.ValidateCropZone(cfg, img.Bounds().Size().X, img.Bounds().Size().Y, params.Crop); err != nil {
+			cfg.Logger.Error("invalid crop zone", "bounds", img.Bounds().Size(), "crop", params.Crop)
+			return nil, &renderError{status: fiber.StatusBadRequest, message: "invalid crop zone"}
+		}
+		// Crop image
+		img = imaging.Crop(img, params.Crop)
+	}
 
-		// Fill background
-		img, err = processing.FillBackground(img, params.BgColor)
+	// Resize image
+	img = processing.ResizeImage(img, params.Width, params.Height, params.Fit, params.Gravity)
+
+	// Fill background - an empty background keeps the transparency
+	if params.BgColor != "" {
+		if params.Format.KeepsAlpha() {
+			// WebP and PNG keep the alpha channel, so even black has to be composited
+			img, err = processing.FlattenBackground(img, params.BgColor)
+		} else {
+			img, err = processing.FillBackground(img, params.BgColor)
+		}
 		if err != nil {
 			cfg.Logger.Error("invalid background color", "bgColor", params.BgColor, "error", err)
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "invalid background color",
-			})
+			return nil, &renderError{status: fiber.StatusBadRequest, message: "invalid background color"}
 		}
+	}
 
-		// Create a buffer to store the encoded image
-		buf := new(bytes.Buffer)
-		if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: params.Quality}); err != nil {
-			cfg.Logger.Error("error encoding image", "error", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "error processing image",
-			})
-		}
+	// Create a buffer to store the encoded image
+	buf := new(bytes.Buffer)
+	encodeOpts := processing.EncodeOptions{
+		Quality:          params.Quality,
+		Lossless:         params.Lossless,
+		CompressionLevel: processing.ParseCompressionLevel(cfg.Png.CompressionLevel),
+	}
+	if err := processing.EncodeImage(buf, img, params.Format, encodeOpts); err != nil {
+		cfg.Logger.Error("error encoding image", "error", err)
+		return nil, &renderError{status: fiber.StatusInternalServerError, message: "error processing image"}
+	}
 
-		// Response header with ETag
-		etag := utils.CalculateETag(buf.Bytes(), params.String())
-		helpers.SetResponseHeaders(c, etag)
+	// Derive the ETag from the source ETag, so it is known before rendering for the next request
+	etag := sourceETag(sourceURL, info, params)
+	if etag == "" {
+		etag = utils.CalculateETag(buf.Bytes(), params.String())
+	}
 
-		// Check if client has matching ETag
-		if match := c.Get("If-None-Match"); match == etag {
-			return c.Status(http.StatusNotModified).Send(nil)
-		}
-		// Send the processed image
-		return c.Send(buf.Bytes())
+	return &cache.Entry{
+		Data:         buf.Bytes(),
+		ContentType:  params.Format.ContentType(),
+		ETag:         etag,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+// sourceETag returns the ETag of the rendering derived from the source metadata or empty if the source has no ETag
+func sourceETag(sourceURL string, info *storage.ObjectInfo, params SizerParams) string {
+	if info.ETag == "" {
+		return ""
+	}
+	return utils.CalculateSourceETag(sourceURL, info.ETag, params.String())
+}
+
+// headSource returns the metadata of the source image or nil if not available
+func headSource(ctx context.Context, backends *storage.Backends, httpFetcher *storage.HTTPFetcher, source *config.SourceConfig, bucket, key, sourceURL string) *storage.ObjectInfo {
+	var info *storage.ObjectInfo
+	var err error
+	if backend := backends.For(source, bucket); backend != nil {
+		info, err = backend.HeadObject(ctx, bucket, key)
+	} else {
+		info, err = httpFetcher.Head(ctx, sourceURL)
+	}
+	if err != nil {
+		return nil
+	}
+	return info
+}
+
+// sendEntry responds with the rendered image or not modified if the client's copy is still valid
+func sendEntry(c *fiber.Ctx, policy config.CacheControl, entry *cache.Entry, params SizerParams) error {
+	helpers.SetResponseHeaders(c, policy, entry.ContentType, entry.ETag, entry.LastModified)
+	if params.AutoFormat {
+		c.Vary(fiber.HeaderAccept)
+	}
+
+	// Check if client has a matching ETag or a copy not older than the source
+	if helpers.IsNotModified(c, entry.ETag, entry.LastModified) {
+		return c.Status(http.StatusNotModified).Send(nil)
+	}
+	// Send the processed image
+	return c.Send(entry.Data)
+}
+
+// loadError converts errors from loading the source image
+func loadError(err error) *renderError {
+	if errors.Is(err, helpers.ErrImageTooLarge) {
+		return &renderError{status: fiber.StatusBadRequest, message: "image dimensions exceed limit"}
+	}
+	if errors.Is(err, helpers.ErrSourceTooLarge) {
+		return &renderError{status: fiber.StatusRequestEntityTooLarge, message: "source image too large"}
+	}
+	if errors.Is(err, helpers.ErrServerBusy) {
+		return &renderError{status: fiber.StatusServiceUnavailable, message: "server busy"}
 	}
+	return &renderError{status: fiber.StatusInternalServerError, message: "error processing image"}
 }
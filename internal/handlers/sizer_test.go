@@ -0,0 +1,407 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spossner/img-sizer/internal/cache"
+	"github.com/spossner/img-sizer/internal/config"
+	"github.com/spossner/img-sizer/internal/handlers/helpers"
+	"github.com/spossner/img-sizer/internal/processing"
+	"github.com/spossner/img-sizer/internal/storage"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSourceURL = "https://images.test/photos/test.png"
+
+// createSizerApp serves a test image from a filesystem source through the combined handler
+func createSizerApp(t *testing.T, outputCache cache.Cache) *fiber.App {
+	t.Helper()
+	return createConfiguredSizerApp(t, outputCache, nil, nil, func(cfg *config.Config) {})
+}
+
+// createConfiguredSizerApp is createSizerApp with the config adjusted before creating the handler
+func createConfiguredSizerApp(t *testing.T, outputCache cache.Cache, pool *processing.Pool, budget *processing.MemoryBudget, configure func(cfg *config.Config)) *fiber.App {
+	t.Helper()
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "photos"), 0o755))
+	file, err := os.Create(filepath.Join(root, "photos", "test.png"))
+	require.NoError(t, err)
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	require.NoError(t, png.Encode(file, img))
+	require.NoError(t, file.Close())
+
+	cfg := &config.Config{
+		AllowedSources: []config.SourceConfig{
+			{Pattern: regexp.MustCompile(`^images\.test$`), Backend: config.BackendFS, Root: root},
+		},
+		AllowAllDimensions: true,
+		MaxInputDimension:  5000,
+		MaxOutputDimension: 2000,
+		Jpeg:               config.Jpeg{Quality: 70, Background: "000000"},
+		Webp:               config.Webp{Quality: 75},
+		Logger:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	configure(cfg)
+	backends, err := storage.NewBackends(context.Background(), cfg.S3, cfg.AllowedSources)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.Get("/v2/resize.jpg", GetCombinedHandler(cfg, backends, nil, outputCache, pool, budget))
+	app.Get("/resize.jpg", GetResizeHandler(cfg, backends, nil, outputCache, pool, budget))
+	return app
+}
+
+func TestImageSizerHandler(t *testing.T) {
+	app := createSizerApp(t, cache.Nop{})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/v2/resize.jpg?width=100&height=100&src="+testSourceURL, nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, "image/jpeg", resp.Header.Get(fiber.HeaderContentType))
+	assert.NotEmpty(t, resp.Header.Get(fiber.HeaderETag))
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	img, _, err := image.Decode(bytes.NewReader(body))
+	require.NoError(t, err)
+	assert.Equal(t, image.Pt(100, 100), img.Bounds().Size())
+
+	// Unknown files are not found in the source directory
+	resp, err = app.Test(httptest.NewRequest("GET", "/v2/resize.jpg?width=100&src=https://images.test/photos/missing.png", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusInternalServerError, resp.StatusCode)
+}
+
+func TestImageSizerHandlerCache(t *testing.T) {
+	memory := cache.NewMemory(10<<20, time.Hour)
+	app := createSizerApp(t, memory)
+
+	request := func(query string) (string, string, []byte) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/v2/resize.jpg?"+query+"&src="+testSourceURL, nil))
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.Header.Get(helpers.HeaderXCache), resp.Header.Get(fiber.HeaderETag), body
+	}
+
+	status, etag, body := request("width=100&height=100")
+	assert.Equal(t, helpers.CacheMiss, status)
+
+	cachedStatus, cachedETag, cachedBody := request("width=100&height=100")
+	assert.Equal(t, helpers.CacheHit, cachedStatus)
+	assert.Equal(t, etag, cachedETag, "cached response should keep the ETag")
+	assert.Equal(t, body, cachedBody)
+
+	// Other params and formats are cached separately
+	status, _, _ = request("width=200&height=200")
+	assert.Equal(t, helpers.CacheMiss, status)
+	status, _, _ = request("width=100&height=100&format=webp")
+	assert.Equal(t, helpers.CacheMiss, status)
+	assert.Equal(t, 3, memory.Len())
+}
+
+// createURLSizerApp serves images loaded from the origin URL through the combined handler
+func createURLSizerApp(t *testing.T, outputCache cache.Cache) *fiber.App {
+	t.Helper()
+	cfg := &config.Config{
+		AllowedSources:     []config.SourceConfig{{Pattern: regexp.MustCompile(`^127\.0\.0\.1$`)}},
+		AllowAllDimensions: true,
+		MaxInputDimension:  5000,
+		MaxOutputDimension: 2000,
+		Jpeg:               config.Jpeg{Quality: 70, Background: "000000"},
+		Logger:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	httpFetcher := storage.NewHTTPFetcher(config.HTTPSource{
+		Timeout:         5 * time.Second,
+		AllowedNetworks: []*net.IPNet{loopback},
+	}, cfg.IsAllowedHost)
+	backends, err := storage.NewBackends(context.Background(), cfg.S3, cfg.AllowedSources)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.Get("/v2/resize.jpg", GetCombinedHandler(cfg, backends, httpFetcher, outputCache, nil, nil))
+	return app
+}
+
+func TestImageSizerHandlerCoalescing(t *testing.T) {
+	// The origin is slow, so all requests arrive while the first one renders
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		time.Sleep(200 * time.Millisecond)
+		png.Encode(w, image.NewRGBA(image.Rect(0, 0, 400, 300)))
+	}))
+	defer server.Close()
+
+	app := createURLSizerApp(t, cache.Nop{})
+
+	const requests = 10
+	var wg sync.WaitGroup
+	etags := make([]string, requests)
+	for i := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := app.Test(httptest.NewRequest("GET", "/v2/resize.jpg?width=100&height=100&src="+server.URL+"/test.png", nil), 5000)
+			if assert.NoError(t, err) && assert.Equal(t, fiber.StatusOK, resp.StatusCode) {
+				etags[i] = resp.Header.Get(fiber.HeaderETag)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), fetches.Load(), "concurrent identical requests should share one rendering")
+	for _, etag := range etags {
+		assert.Equal(t, etags[0], etag)
+	}
+}
+
+func TestImageSizerHandlerNotModified(t *testing.T) {
+	var sourceETag atomic.Value
+	sourceETag.Store(`"v1"`)
+	var gets, heads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", sourceETag.Load().(string))
+		if r.Method == http.MethodHead {
+			heads.Add(1)
+			return
+		}
+		gets.Add(1)
+		png.Encode(w, image.NewRGBA(image.Rect(0, 0, 400, 300)))
+	}))
+	defer server.Close()
+
+	app := createURLSizerApp(t, cache.Nop{})
+	request := func(ifNoneMatch string) *http.Response {
+		req := httptest.NewRequest("GET", "/v2/resize.jpg?width=100&height=100&src="+server.URL+"/test.png", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set(fiber.HeaderIfNoneMatch, ifNoneMatch)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := request("")
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get(fiber.HeaderETag)
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, int32(1), gets.Load())
+
+	// The ETag is derived from the source, so a HEAD request is enough to answer a conditional request
+	resp = request(etag)
+	assert.Equal(t, fiber.StatusNotModified, resp.StatusCode)
+	assert.Equal(t, etag, resp.Header.Get(fiber.HeaderETag))
+	assert.Equal(t, int32(1), gets.Load(), "unchanged source should not be downloaded")
+	assert.Equal(t, int32(1), heads.Load())
+
+	// A changed source is rendered again with a new ETag
+	sourceETag.Store(`"v2"`)
+	resp = request(etag)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.NotEqual(t, etag, resp.Header.Get(fiber.HeaderETag))
+	assert.Equal(t, int32(2), gets.Load())
+}
+
+func TestImageSizerHandlerNotModifiedFromCache(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		png.Encode(w, image.NewRGBA(image.Rect(0, 0, 400, 300)))
+	}))
+	defer server.Close()
+
+	app := createURLSizerApp(t, cache.NewMemory(10<<20, time.Hour))
+	path := "/v2/resize.jpg?width=100&height=100&src=" + server.URL + "/test.png"
+
+	resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+	require.NoError(t, err)
+	etag := resp.Header.Get(fiber.HeaderETag)
+
+	// Cached renderings are revalidated without any origin request
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set(fiber.HeaderIfNoneMatch, etag)
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNotModified, resp.StatusCode)
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestImageSizerHandlerIfModifiedSince(t *testing.T) {
+	const lastModified = "Sat, 01 Mar 2025 12:00:00 GMT"
+	var gets atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// No ETag, so only the modification time identifies the source version
+		w.Header().Set("Last-Modified", lastModified)
+		if r.Method == http.MethodGet {
+			gets.Add(1)
+			png.Encode(w, image.NewRGBA(image.Rect(0, 0, 400, 300)))
+		}
+	}))
+	defer server.Close()
+
+	app := createURLSizerApp(t, cache.Nop{})
+	request := func(ifModifiedSince string) *http.Response {
+		req := httptest.NewRequest("GET", "/v2/resize.jpg?width=100&height=100&src="+server.URL+"/test.png", nil)
+		if ifModifiedSince != "" {
+			req.Header.Set(fiber.HeaderIfModifiedSince, ifModifiedSince)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := request("")
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, lastModified, resp.Header.Get(fiber.HeaderLastModified), "source modification time should be propagated")
+
+	resp = request(lastModified)
+	assert.Equal(t, fiber.StatusNotModified, resp.StatusCode)
+	assert.Equal(t, lastModified, resp.Header.Get(fiber.HeaderLastModified))
+	assert.Equal(t, int32(1), gets.Load(), "unmodified source should not be downloaded")
+
+	resp = request("Fri, 28 Feb 2025 12:00:00 GMT")
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), gets.Load())
+}
+
+func TestImageSizerHandlerCacheControl(t *testing.T) {
+	global := config.CacheControl{MaxAge: 24 * time.Hour, SMaxAge: 7 * 24 * time.Hour, Immutable: true, ErrorMaxAge: time.Minute}
+	deprecated := &config.CacheControl{MaxAge: time.Hour}
+	source := &config.CacheControl{MaxAge: 10 * time.Minute, StaleIfError: time.Hour}
+
+	tests := []struct {
+		name     string
+		source   *config.CacheControl
+		url      string
+		status   int
+		expected string
+	}{
+		{
+			name:     "global policy",
+			url:      "/v2/resize.jpg?width=100&src=" + testSourceURL,
+			status:   fiber.StatusOK,
+			expected: "public, max-age=86400, s-maxage=604800, immutable",
+		},
+		{
+			name:     "route policy",
+			url:      "/resize.jpg?width=100&height=100&src=" + testSourceURL,
+			status:   fiber.StatusOK,
+			expected: "public, max-age=3600",
+		},
+		{
+			name:     "source policy overrides route",
+			source:   source,
+			url:      "/resize.jpg?width=100&height=100&src=" + testSourceURL,
+			status:   fiber.StatusOK,
+			expected: "public, max-age=600, stale-if-error=3600",
+		},
+		{
+			name:     "error response",
+			url:      "/v2/resize.jpg?width=100&src=https://images.test/photos/missing.png",
+			status:   fiber.StatusInternalServerError,
+			expected: "public, max-age=60",
+		},
+		{
+			name:     "invalid request",
+			url:      "/v2/resize.jpg?width=100",
+			status:   fiber.StatusBadRequest,
+			expected: "public, max-age=60",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := createConfiguredSizerApp(t, cache.Nop{}, nil, nil, func(cfg *config.Config) {
+				cfg.CacheControl = global
+				cfg.RouteCacheControl = map[string]*config.CacheControl{"/resize.jpg": deprecated}
+				cfg.AllowedSources[0].CacheControl = tt.source
+			})
+
+			resp, err := app.Test(httptest.NewRequest("GET", tt.url, nil))
+			require.NoError(t, err)
+			assert.Equal(t, tt.status, resp.StatusCode)
+			assert.Equal(t, tt.expected, resp.Header.Get(fiber.HeaderCacheControl))
+		})
+	}
+}
+
+func TestImageSizerHandlerBusy(t *testing.T) {
+	pool := processing.NewPool(1, 0, 0)
+	app := createConfiguredSizerApp(t, cache.Nop{}, pool, nil, func(cfg *config.Config) {
+		cfg.CacheControl = config.CacheControl{MaxAge: time.Hour, ErrorMaxAge: time.Minute}
+		cfg.Processing.RetryAfter = 1500 * time.Millisecond
+	})
+	url := "/v2/resize.jpg?width=100&src=" + testSourceURL
+
+	// Requests are rejected while all slots are in use and the queue is full
+	release, err := pool.Acquire(context.Background())
+	require.NoError(t, err)
+	resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get(fiber.HeaderRetryAfter))
+	assert.Equal(t, "no-store", resp.Header.Get(fiber.HeaderCacheControl))
+
+	release()
+	resp, err = app.Test(httptest.NewRequest("GET", url, nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, 0, pool.InUse(), "the slot is released after rendering")
+}
+
+func TestImageSizerHandlerMemoryBudget(t *testing.T) {
+	// The 400x300 test image needs 480000 bytes when decoded
+	tests := []struct {
+		name    string
+		limit   int64
+		reserve int64
+		status  int
+	}{
+		{name: "fits into budget", limit: 480_000, status: fiber.StatusOK},
+		{name: "exceeds whole budget", limit: 479_999, status: fiber.StatusBadRequest},
+		{name: "budget in use", limit: 480_000, reserve: 1, status: fiber.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			budget := processing.NewMemoryBudget(tt.limit, 10*time.Millisecond)
+			if tt.reserve > 0 {
+				release, err := budget.Reserve(context.Background(), tt.reserve)
+				require.NoError(t, err)
+				defer release()
+			}
+			app := createConfiguredSizerApp(t, cache.Nop{}, nil, budget, func(cfg *config.Config) {})
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/v2/resize.jpg?width=100&src="+testSourceURL, nil))
+			require.NoError(t, err)
+			assert.Equal(t, tt.status, resp.StatusCode)
+			assert.Equal(t, tt.reserve, budget.Stats().UsedBytes, "the budget is released after rendering")
+		})
+	}
+}
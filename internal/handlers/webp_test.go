@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/spossner/img-sizer/internal/cache"
+	"github.com/spossner/img-sizer/internal/config"
+	"github.com/spossner/img-sizer/internal/processing"
+	"github.com/spossner/img-sizer/internal/storage"
+
+	"github.com/chai2010/webp"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestWebpParamsParser(t *testing.T) {
+	// Create test config
+	cfg := &config.Config{
+		MaxInputDimension:  5000,
+		MaxOutputDimension: 2000,
+		AllowAllDimensions: true,
+		Jpeg: config.Jpeg{
+			Quality:    70,
+			Background: "000000",
+		},
+		Webp: config.Webp{
+			Quality:  75,
+			Lossless: false,
+		},
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedParams SizerParams
+	}{
+		{
+			name:  "webp defaults",
+			query: "width=800&height=600",
+			expectedParams: SizerParams{
+				Width:   800,
+				Height:  600,
+				Quality: 75,
+				Density: 1.0,
+				Scale:   1.0,
+				Crop:    image.Rectangle{},
+				Fit:     processing.FitFill,
+				Format:  processing.FormatWebP,
+			},
+		},
+		{
+			name:  "with quality parameter",
+			query: "width=800&height=600&quality=90",
+			expectedParams: SizerParams{
+				Width:   800,
+				Height:  600,
+				Quality: 90,
+				Density: 1.0,
+				Scale:   1.0,
+				Crop:    image.Rectangle{},
+				Fit:     processing.FitFill,
+				Format:  processing.FormatWebP,
+			},
+		},
+		{
+			name:  "lossless",
+			query: "width=800&height=600&lossless=true",
+			expectedParams: SizerParams{
+				Width:    800,
+				Height:   600,
+				Quality:  75,
+				Density:  1.0,
+				Scale:    1.0,
+				Crop:     image.Rectangle{},
+				Fit:      processing.FitFill,
+				Format:   processing.FormatWebP,
+				Lossless: true,
+			},
+		},
+		{
+			name:  "with background",
+			query: "width=800&height=600&background=000000",
+			expectedParams: SizerParams{
+				Width:   800,
+				Height:  600,
+				Quality: 75,
+				BgColor: "000000",
+				Density: 1.0,
+				Scale:   1.0,
+				Crop:    image.Rectangle{},
+				Fit:     processing.FitFill,
+				Format:  processing.FormatWebP,
+			},
+		},
+		{
+			name:  "with crop and density",
+			query: "width=100&height=100&crop[x]=10&crop[y]=20&crop[width]=200&crop[height]=200&density=2.0",
+			expectedParams: SizerParams{
+				Width:   200,
+				Height:  200,
+				Quality: 75,
+				Density: 2.0,
+				Scale:   1.0,
+				Crop:    image.Rect(10, 20, 210, 220),
+				Fit:     processing.FitFill,
+				Format:  processing.FormatWebP,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			ctx := app.AcquireCtx(&fasthttp.RequestCtx{})
+			ctx.Request().SetRequestURI("?" + tt.query)
+
+			params := webpParamsParser(ctx, cfg)
+
+			if params != tt.expectedParams {
+				t.Errorf("webpParamsParser() = %+v, want %+v", params, tt.expectedParams)
+			}
+
+			app.ReleaseCtx(ctx)
+		})
+	}
+}
+
+func TestWebpHandlerTransparency(t *testing.T) {
+	// A transparent source with an opaque red square in the center
+	root := t.TempDir()
+	file, err := os.Create(filepath.Join(root, "logo.png"))
+	require.NoError(t, err)
+	src := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	for y := 25; y < 75; y++ {
+		for x := 75; x < 125; x++ {
+			src.SetNRGBA(x, y, color.NRGBA{R: 255, A: 255})
+		}
+	}
+	require.NoError(t, png.Encode(file, src))
+	require.NoError(t, file.Close())
+
+	cfg := &config.Config{
+		AllowedSources: []config.SourceConfig{
+			{Pattern: regexp.MustCompile(`^images\.test$`), Backend: config.BackendFS, Root: root},
+		},
+		AllowAllDimensions: true,
+		MaxInputDimension:  5000,
+		MaxOutputDimension: 2000,
+		Jpeg:               config.Jpeg{Quality: 70, Background: "000000"},
+		Webp:               config.Webp{Quality: 75, Lossless: true},
+		Logger:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	backends, err := storage.NewBackends(context.Background(), cfg.S3, cfg.AllowedSources)
+	require.NoError(t, err)
+	app := fiber.New()
+	app.Get("/v2/resize.webp", GetWebpHandler(cfg, backends, nil, cache.Nop{}, nil, nil))
+
+	tests := []struct {
+		name     string
+		query    string
+		expected color.NRGBA
+	}{
+		{name: "keeps transparency by default", query: "", expected: color.NRGBA{}},
+		{name: "black background", query: "&background=000000", expected: color.NRGBA{A: 255}},
+		{name: "white background", query: "&background=ffffff", expected: color.NRGBA{R: 255, G: 255, B: 255, A: 255}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest("GET", "/v2/resize.webp?width=100&height=100&fit=pad&src=https://images.test/logo.png"+tt.query, nil))
+			require.NoError(t, err)
+			require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+			img, err := webp.Decode(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, image.Pt(100, 100), img.Bounds().Size())
+			// The letterbox padding and the transparent corners of the source get the background
+			for _, p := range []image.Point{{50, 5}, {50, 95}, {2, 50}} {
+				assert.Equal(t, tt.expected, color.NRGBAModel.Convert(img.At(p.X, p.Y)), "pixel %v", p)
+			}
+			// The opaque center is unchanged
+			assert.Equal(t, color.NRGBA{R: 255, A: 255}, color.NRGBAModel.Convert(img.At(50, 50)))
+		})
+	}
+}
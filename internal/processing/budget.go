@@ -0,0 +1,155 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrExceedsBudget = errors.New("image exceeds the memory budget")
+	ErrBudgetTimeout = errors.New("timed out waiting for memory budget")
+)
+
+// bytesPerPixel is the size of a decoded pixel, images are estimated as RGBA
+const bytesPerPixel = 4
+
+// EstimateDecodeBytes returns the estimated memory used by decoding an image of the given dimensions
+func EstimateDecodeBytes(width, height int) int64 {
+	return int64(width) * int64(height) * bytesPerPixel
+}
+
+// MemoryBudget admits decoding images as long as their estimated memory fits into a global budget.
+// Requests that don't fit wait until enough memory is released. A nil budget admits everything.
+type MemoryBudget struct {
+	limit   int64
+	timeout time.Duration
+
+	mu    sync.Mutex
+	stats BudgetStats
+	// released is closed and replaced whenever memory is released to wake up waiting requests
+	released chan struct{}
+}
+
+// BudgetStats reports the usage of the memory budget
+type BudgetStats struct {
+	LimitBytes int64 `json:"limit_bytes"`
+	UsedBytes  int64 `json:"used_bytes"`
+	PeakBytes  int64 `json:"peak_bytes"`
+	InUse      int   `json:"in_use"`
+	Waiting    int   `json:"waiting"`
+	Admitted   int64 `json:"admitted"`
+	Waited     int64 `json:"waited"`
+	Rejected   int64 `json:"rejected"`
+	TimedOut   int64 `json:"timed_out"`
+}
+
+// NewMemoryBudget creates a budget of limit bytes, requests wait at most timeout for memory, no limit if zero.
+// Returns nil if limit is not positive.
+func NewMemoryBudget(limit int64, timeout time.Duration) *MemoryBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &MemoryBudget{
+		limit:    limit,
+		timeout:  timeout,
+		stats:    BudgetStats{LimitBytes: limit},
+		released: make(chan struct{}),
+	}
+}
+
+// Reserve waits until the bytes fit into the budget. The returned function releases them and must be called once the image is processed.
+// Requests larger than the whole budget are rejected right away.
+func (b *MemoryBudget) Reserve(ctx context.Context, bytes int64) (func(), error) {
+	if b == nil {
+		return func() {}, nil
+	}
+
+	b.mu.Lock()
+	if bytes > b.limit {
+		b.stats.Rejected++
+		b.mu.Unlock()
+		return nil, ErrExceedsBudget
+	}
+	if b.tryReserve(bytes) {
+		b.mu.Unlock()
+		return b.releaseFunc(bytes), nil
+	}
+	b.stats.Waiting++
+	b.stats.Waited++
+	b.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if b.timeout > 0 {
+		timer := time.NewTimer(b.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for {
+		b.mu.Lock()
+		if b.tryReserve(bytes) {
+			b.stats.Waiting--
+			b.mu.Unlock()
+			return b.releaseFunc(bytes), nil
+		}
+		released := b.released
+		b.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-timeout:
+			b.abortWait(true)
+			return nil, ErrBudgetTimeout
+		case <-ctx.Done():
+			b.abortWait(false)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// tryReserve takes the bytes if they fit into the remaining budget, the lock must be held
+func (b *MemoryBudget) tryReserve(bytes int64) bool {
+	if b.stats.UsedBytes+bytes > b.limit {
+		return false
+	}
+	b.stats.UsedBytes += bytes
+	b.stats.PeakBytes = max(b.stats.PeakBytes, b.stats.UsedBytes)
+	b.stats.InUse++
+	b.stats.Admitted++
+	return true
+}
+
+func (b *MemoryBudget) abortWait(timedOut bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stats.Waiting--
+	if timedOut {
+		b.stats.TimedOut++
+	}
+}
+
+// releaseFunc returns the function releasing the bytes, calling it more than once has no effect
+func (b *MemoryBudget) releaseFunc(bytes int64) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.stats.UsedBytes -= bytes
+			b.stats.InUse--
+			close(b.released)
+			b.released = make(chan struct{})
+		})
+	}
+}
+
+// Stats returns a snapshot of the budget usage
+func (b *MemoryBudget) Stats() BudgetStats {
+	if b == nil {
+		return BudgetStats{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
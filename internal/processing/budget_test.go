@@ -0,0 +1,83 @@
+package processing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateDecodeBytes(t *testing.T) {
+	assert.Equal(t, int64(40_000), EstimateDecodeBytes(100, 100))
+	assert.Equal(t, int64(4*60000*60000), EstimateDecodeBytes(60000, 60000), "large images must not overflow")
+}
+
+func TestMemoryBudget(t *testing.T) {
+	budget := NewMemoryBudget(1000, time.Second)
+
+	release1, err := budget.Reserve(context.Background(), 600)
+	require.NoError(t, err)
+	release2, err := budget.Reserve(context.Background(), 400)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), budget.Stats().UsedBytes)
+
+	// Images larger than the whole budget are never admitted
+	_, err = budget.Reserve(context.Background(), 1001)
+	assert.ErrorIs(t, err, ErrExceedsBudget)
+
+	// A request waits until enough memory is released
+	admitted := make(chan error)
+	go func() {
+		release, err := budget.Reserve(context.Background(), 500)
+		if err == nil {
+			defer release()
+		}
+		admitted <- err
+	}()
+	require.Eventually(t, func() bool { return budget.Stats().Waiting == 1 }, time.Second, time.Millisecond)
+
+	release2()
+	release2() // releasing twice has no effect
+	select {
+	case <-admitted:
+		t.Fatal("request admitted before enough memory was released")
+	case <-time.After(20 * time.Millisecond):
+	}
+	release1()
+	assert.NoError(t, <-admitted)
+
+	assert.Eventually(t, func() bool { return budget.Stats().UsedBytes == 0 }, time.Second, time.Millisecond)
+	stats := budget.Stats()
+	assert.Equal(t, BudgetStats{LimitBytes: 1000, PeakBytes: 1000, Admitted: 3, Waited: 1, Rejected: 1}, stats)
+}
+
+func TestMemoryBudgetTimeout(t *testing.T) {
+	budget := NewMemoryBudget(1000, 10*time.Millisecond)
+	release, err := budget.Reserve(context.Background(), 1000)
+	require.NoError(t, err)
+	defer release()
+
+	_, err = budget.Reserve(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrBudgetTimeout)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = budget.Reserve(ctx, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	stats := budget.Stats()
+	assert.Equal(t, 0, stats.Waiting)
+	assert.Equal(t, int64(1), stats.TimedOut)
+}
+
+func TestNilMemoryBudget(t *testing.T) {
+	budget := NewMemoryBudget(0, time.Second)
+	assert.Nil(t, budget)
+
+	release, err := budget.Reserve(context.Background(), 1<<40)
+	require.NoError(t, err)
+	release()
+	assert.Equal(t, BudgetStats{}, budget.Stats())
+}
@@ -0,0 +1,89 @@
+package processing
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+
+	"github.com/chai2010/webp"
+)
+
+type Format string
+
+const (
+	FormatJPEG Format = "jpeg"
+	FormatWebP Format = "webp"
+	FormatPNG  Format = "png"
+	FormatAuto Format = "auto"
+)
+
+// ParseFormat maps a format name like "jpg" or "webp" to its Format
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "jpg", "jpeg":
+		return FormatJPEG, nil
+	case "webp":
+		return FormatWebP, nil
+	case "png":
+		return FormatPNG, nil
+	case "auto":
+		return FormatAuto, nil
+	default:
+		return "", fmt.Errorf("unsupported output format %q", name)
+	}
+}
+
+// ContentType returns the MIME type sent for images encoded in the given format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatWebP:
+		return "image/webp"
+	case FormatPNG:
+		return "image/png"
+	default:
+		return "image/jpeg"
+	}
+}
+
+// KeepsAlpha reports whether images encoded in the format keep their transparency
+func (f Format) KeepsAlpha() bool {
+	return f == FormatWebP || f == FormatPNG
+}
+
+type EncodeOptions struct {
+	Quality          int
+	Lossless         bool
+	CompressionLevel png.CompressionLevel
+}
+
+// ParseCompressionLevel maps a configured PNG compression name to its level, falling back to the default
+func ParseCompressionLevel(name string) png.CompressionLevel {
+	switch strings.ToLower(name) {
+	case "none":
+		return png.NoCompression
+	case "best_speed":
+		return png.BestSpeed
+	case "best_compression":
+		return png.BestCompression
+	default:
+		return png.DefaultCompression
+	}
+}
+
+// EncodeImage writes the image in the requested output format to w
+func EncodeImage(w io.Writer, img image.Image, format Format, opts EncodeOptions) error {
+	switch format {
+	case FormatJPEG, "":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: opts.Quality})
+	case FormatWebP:
+		return webp.Encode(w, img, &webp.Options{Quality: float32(opts.Quality), Lossless: opts.Lossless})
+	case FormatPNG:
+		encoder := &png.Encoder{CompressionLevel: opts.CompressionLevel}
+		return encoder.Encode(w, img)
+	default:
+		return fmt.Errorf("unsupported output format %q", format)
+	}
+}
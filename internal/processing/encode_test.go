@@ -0,0 +1,148 @@
+package processing
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/chai2010/webp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeImage(t *testing.T) {
+	original := createTestImage(100, 80, color.RGBA{R: 255, G: 0, B: 0, A: 255})
+
+	tests := []struct {
+		name    string
+		format  Format
+		opts    EncodeOptions
+		decode  func(buf *bytes.Buffer) (image.Image, error)
+		wantErr bool
+	}{
+		{
+			name:   "jpeg",
+			format: FormatJPEG,
+			opts:   EncodeOptions{Quality: 70},
+			decode: func(buf *bytes.Buffer) (image.Image, error) { return jpeg.Decode(buf) },
+		},
+		{
+			name:   "default format is jpeg",
+			format: "",
+			opts:   EncodeOptions{Quality: 70},
+			decode: func(buf *bytes.Buffer) (image.Image, error) { return jpeg.Decode(buf) },
+		},
+		{
+			name:   "lossy webp",
+			format: FormatWebP,
+			opts:   EncodeOptions{Quality: 75},
+			decode: func(buf *bytes.Buffer) (image.Image, error) { return webp.Decode(buf) },
+		},
+		{
+			name:   "lossless webp",
+			format: FormatWebP,
+			opts:   EncodeOptions{Quality: 75, Lossless: true},
+			decode: func(buf *bytes.Buffer) (image.Image, error) { return webp.Decode(buf) },
+		},
+		{
+			name:   "png",
+			format: FormatPNG,
+			decode: func(buf *bytes.Buffer) (image.Image, error) { return png.Decode(buf) },
+		},
+		{
+			name:    "unsupported format",
+			format:  Format("bmp"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			err := EncodeImage(buf, original, tt.format, tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			decoded, err := tt.decode(buf)
+			assert.NoError(t, err)
+			assert.Equal(t, original.Bounds().Size(), decoded.Bounds().Size(), "decoded size should match original")
+		})
+	}
+}
+
+func TestEncodeWebpQuality(t *testing.T) {
+	original := createTestImage(200, 200, color.RGBA{R: 255, G: 0, B: 0, A: 255})
+
+	low := new(bytes.Buffer)
+	high := new(bytes.Buffer)
+	assert.NoError(t, EncodeImage(low, original, FormatWebP, EncodeOptions{Quality: 10}))
+	assert.NoError(t, EncodeImage(high, original, FormatWebP, EncodeOptions{Quality: 100}))
+
+	assert.Less(t, low.Len(), high.Len(), "lower quality should produce smaller output")
+}
+
+func TestEncodePngKeepsTransparency(t *testing.T) {
+	original := createTestImage(100, 100, color.RGBA{R: 255, G: 0, B: 0, A: 255})
+
+	buf := new(bytes.Buffer)
+	assert.NoError(t, EncodeImage(buf, original, FormatPNG, EncodeOptions{CompressionLevel: png.BestCompression}))
+
+	decoded, err := png.Decode(buf)
+	assert.NoError(t, err)
+	_, _, _, alpha := decoded.At(10, 90).RGBA()
+	assert.Equal(t, uint32(0), alpha, "transparent area should stay transparent")
+}
+
+func TestParseCompressionLevel(t *testing.T) {
+	assert.Equal(t, png.DefaultCompression, ParseCompressionLevel(""))
+	assert.Equal(t, png.DefaultCompression, ParseCompressionLevel("default"))
+	assert.Equal(t, png.NoCompression, ParseCompressionLevel("none"))
+	assert.Equal(t, png.BestSpeed, ParseCompressionLevel("best_speed"))
+	assert.Equal(t, png.BestCompression, ParseCompressionLevel("BEST_COMPRESSION"))
+}
+
+func TestFormatContentType(t *testing.T) {
+	assert.Equal(t, "image/jpeg", FormatJPEG.ContentType())
+	assert.Equal(t, "image/webp", FormatWebP.ContentType())
+	assert.Equal(t, "image/png", FormatPNG.ContentType())
+	assert.Equal(t, "image/jpeg", Format("").ContentType())
+}
+
+func TestFormatKeepsAlpha(t *testing.T) {
+	assert.False(t, FormatJPEG.KeepsAlpha())
+	assert.True(t, FormatWebP.KeepsAlpha())
+	assert.True(t, FormatPNG.KeepsAlpha())
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected Format
+		wantErr  bool
+	}{
+		{name: "jpg", expected: FormatJPEG},
+		{name: "JPEG", expected: FormatJPEG},
+		{name: "webp", expected: FormatWebP},
+		{name: "png", expected: FormatPNG},
+		{name: "auto", expected: FormatAuto},
+		{name: "gif", wantErr: true},
+		{name: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := ParseFormat(tt.name)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, format)
+		})
+	}
+}
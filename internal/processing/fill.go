@@ -15,11 +15,17 @@ const (
 	Black = "000000"
 )
 
+// FillBackground flattens transparent areas onto the given background color.
+// Black is skipped since JPEG encoding drops the alpha channel onto black anyway.
 func FillBackground(img image.Image, bgColor string) (image.Image, error) {
 	if bgColor == Black {
 		return img, nil
 	}
+	return FlattenBackground(img, bgColor)
+}
 
+// FlattenBackground composites the image over an opaque background of the given color
+func FlattenBackground(img image.Image, bgColor string) (image.Image, error) {
 	if !validators.IsValidHexColor(bgColor) {
 		return nil, errors.New("invalid hex color")
 	}
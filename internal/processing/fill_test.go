@@ -204,3 +204,44 @@ func TestFillBackgroundWithPartialTransparency(t *testing.T) {
 		})
 	}
 }
+
+func TestFlattenBackground(t *testing.T) {
+	transparent := createTestImage(100, 100, color.RGBA{R: 0, G: 0, B: 0, A: 0})
+
+	tests := []struct {
+		name      string
+		bgColor   string
+		expected  color.Color
+		shouldErr bool
+	}{
+		{
+			name:     "black is composited",
+			bgColor:  Black,
+			expected: color.RGBA{R: 0, G: 0, B: 0, A: 255},
+		},
+		{
+			name:     "white background",
+			bgColor:  "FFFFFF",
+			expected: color.RGBA{R: 255, G: 255, B: 255, A: 255},
+		},
+		{
+			name:      "invalid hex color",
+			bgColor:   "invalid",
+			shouldErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := FlattenBackground(transparent, tt.bgColor)
+			if tt.shouldErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			assert.Equal(t, transparent.Bounds(), result.Bounds(), "image bounds should not change")
+			assertColorEqual(t, result.At(10, 90), tt.expected, "background color should be opaque")
+		})
+	}
+}
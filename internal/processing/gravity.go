@@ -0,0 +1,127 @@
+package processing
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// Gravity defines which part of the image is kept when cropping to fill a box.
+// The zero value keeps the center.
+type Gravity struct {
+	Anchor imaging.Anchor
+	// Focal marks an explicit focal point given by X and Y relative to the image size (0..1)
+	Focal bool
+	X     float64
+	Y     float64
+	// Smart picks the focal point from the image content
+	Smart bool
+}
+
+var gravityAnchors = map[string]imaging.Anchor{
+	"center":    imaging.Center,
+	"north":     imaging.Top,
+	"northeast": imaging.TopRight,
+	"east":      imaging.Right,
+	"southeast": imaging.BottomRight,
+	"south":     imaging.Bottom,
+	"southwest": imaging.BottomLeft,
+	"west":      imaging.Left,
+	"northwest": imaging.TopLeft,
+}
+
+var gravityAliases = map[string]string{
+	"ce": "center",
+	"n":  "north",
+	"ne": "northeast",
+	"e":  "east",
+	"se": "southeast",
+	"s":  "south",
+	"sw": "southwest",
+	"w":  "west",
+	"nw": "northwest",
+}
+
+// ParseGravity parses a compass direction like "north" or "ne", a focal point like "fp:0.3,0.2" or "smart"
+func ParseGravity(value string) (Gravity, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	if value == "smart" {
+		return Gravity{Smart: true}, nil
+	}
+
+	if point, ok := strings.CutPrefix(value, "fp:"); ok {
+		xs, ys, found := strings.Cut(point, ",")
+		if !found {
+			return Gravity{}, fmt.Errorf("invalid focal point %q", value)
+		}
+		x, errX := strconv.ParseFloat(strings.TrimSpace(xs), 64)
+		y, errY := strconv.ParseFloat(strings.TrimSpace(ys), 64)
+		if errX != nil || errY != nil || x < 0 || x > 1 || y < 0 || y > 1 {
+			return Gravity{}, fmt.Errorf("invalid focal point %q", value)
+		}
+		return Gravity{Focal: true, X: x, Y: y}, nil
+	}
+
+	if name, ok := gravityAliases[value]; ok {
+		value = name
+	}
+	anchor, ok := gravityAnchors[value]
+	if !ok {
+		return Gravity{}, fmt.Errorf("unsupported gravity %q", value)
+	}
+	return Gravity{Anchor: anchor}, nil
+}
+
+func (g Gravity) String() string {
+	if g.Smart {
+		return "smart"
+	}
+	if g.Focal {
+		// Formatted exactly, focal points differing in any digit render differently
+		return "fp:" + strconv.FormatFloat(g.X, 'g', -1, 64) + "," + strconv.FormatFloat(g.Y, 'g', -1, 64)
+	}
+	for name, anchor := range gravityAnchors {
+		if anchor == g.Anchor {
+			return name
+		}
+	}
+	return "center"
+}
+
+// fillImage scales and crops the image to cover the whole box, keeping the part defined by gravity
+func fillImage(img image.Image, width, height int, gravity Gravity) image.Image {
+	if gravity.Smart {
+		gravity = smartFocalPoint(img, width, height)
+	}
+	if !gravity.Focal {
+		return imaging.Fill(img, width, height, gravity.Anchor, imaging.Lanczos)
+	}
+
+	// Crop the largest window with the target aspect ratio centered on the focal point
+	srcWidth, srcHeight := img.Bounds().Dx(), img.Bounds().Dy()
+	cropWidth, cropHeight := cropDimensions(srcWidth, srcHeight, width, height)
+
+	x := clamp(int(math.Round(gravity.X*float64(srcWidth)))-cropWidth/2, 0, srcWidth-cropWidth)
+	y := clamp(int(math.Round(gravity.Y*float64(srcHeight)))-cropHeight/2, 0, srcHeight-cropHeight)
+	origin := img.Bounds().Min
+
+	cropped := imaging.Crop(img, image.Rect(origin.X+x, origin.Y+y, origin.X+x+cropWidth, origin.Y+y+cropHeight))
+	return imaging.Resize(cropped, width, height, imaging.Lanczos)
+}
+
+// cropDimensions returns the largest size with the target aspect ratio fitting into the source
+func cropDimensions(srcWidth, srcHeight, width, height int) (int, int) {
+	if float64(srcWidth)/float64(srcHeight) > float64(width)/float64(height) {
+		return int(math.Max(1, math.Round(float64(srcHeight)*float64(width)/float64(height)))), srcHeight
+	}
+	return srcWidth, int(math.Max(1, math.Round(float64(srcWidth)*float64(height)/float64(width))))
+}
+
+func clamp(value, low, high int) int {
+	return max(low, min(value, high))
+}
@@ -0,0 +1,106 @@
+package processing
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+)
+
+// createSplitImage creates a portrait test image with a red upper half and a blue lower half
+func createSplitImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if y < height/2 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+	return img
+}
+
+func TestParseGravity(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected Gravity
+		wantErr  bool
+	}{
+		{name: "center", value: "center", expected: Gravity{Anchor: imaging.Center}},
+		{name: "north", value: "north", expected: Gravity{Anchor: imaging.Top}},
+		{name: "short northeast", value: "ne", expected: Gravity{Anchor: imaging.TopRight}},
+		{name: "upper case", value: "SouthWest", expected: Gravity{Anchor: imaging.BottomLeft}},
+		{name: "focal point", value: "fp:0.3,0.2", expected: Gravity{Focal: true, X: 0.3, Y: 0.2}},
+		{name: "focal point with spaces", value: "fp: 1, 0", expected: Gravity{Focal: true, X: 1, Y: 0}},
+		{name: "smart", value: "smart", expected: Gravity{Smart: true}},
+		{name: "focal point out of range", value: "fp:1.5,0.2", wantErr: true},
+		{name: "focal point missing y", value: "fp:0.3", wantErr: true},
+		{name: "focal point not a number", value: "fp:a,b", wantErr: true},
+		{name: "unknown direction", value: "up", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gravity, err := ParseGravity(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, gravity)
+		})
+	}
+}
+
+func TestGravityString(t *testing.T) {
+	assert.Equal(t, "center", Gravity{}.String())
+	assert.Equal(t, "north", Gravity{Anchor: imaging.Top}.String())
+	assert.Equal(t, "southeast", Gravity{Anchor: imaging.BottomRight}.String())
+	assert.Equal(t, "fp:0.3,0.2", Gravity{Focal: true, X: 0.3, Y: 0.2}.String())
+	assert.Equal(t, "fp:1,0", Gravity{Focal: true, X: 1, Y: 0}.String())
+	assert.NotEqual(t, Gravity{Focal: true, X: 0.3001, Y: 0.2}.String(), Gravity{Focal: true, X: 0.3004, Y: 0.2}.String())
+	assert.Equal(t, "smart", Gravity{Smart: true}.String())
+}
+
+func TestResizeImageWithGravity(t *testing.T) {
+	original := createSplitImage(100, 200)
+	red := color.RGBA{R: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+
+	tests := []struct {
+		name     string
+		gravity  Gravity
+		expected color.Color
+	}{
+		{name: "north keeps upper half", gravity: Gravity{Anchor: imaging.Top}, expected: red},
+		{name: "south keeps lower half", gravity: Gravity{Anchor: imaging.Bottom}, expected: blue},
+		{name: "focal point in upper half", gravity: Gravity{Focal: true, X: 0.5, Y: 0.1}, expected: red},
+		{name: "focal point in lower half", gravity: Gravity{Focal: true, X: 0.5, Y: 0.9}, expected: blue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resized := ResizeImage(original, 50, 50, FitFill, tt.gravity)
+
+			assert.Equal(t, 50, resized.Bounds().Dx(), "width should match expected")
+			assert.Equal(t, 50, resized.Bounds().Dy(), "height should match expected")
+			assertColorEqual(t, tt.expected, resized.At(25, 25), "kept region should match gravity")
+		})
+	}
+}
+
+func TestResizeImageWithFocalPointOnWideImage(t *testing.T) {
+	// Landscape image with a red left half and a blue right half
+	original := imaging.Rotate90(createSplitImage(100, 200))
+
+	resized := ResizeImage(original, 50, 50, FitFill, Gravity{Focal: true, X: 0.95, Y: 0.5})
+
+	assert.Equal(t, 50, resized.Bounds().Dx(), "width should match expected")
+	assert.Equal(t, 50, resized.Bounds().Dy(), "height should match expected")
+	assertColorEqual(t, resized.At(25, 25), color.RGBA{B: 255, A: 255}, "focal point should be kept")
+}
@@ -0,0 +1,90 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrQueueFull    = errors.New("processing queue is full")
+	ErrQueueTimeout = errors.New("timed out waiting for processing")
+)
+
+// Pool bounds the number of images processed concurrently, further requests wait in a queue of limited depth.
+// A nil pool does not limit processing.
+type Pool struct {
+	slots   chan struct{}
+	queue   chan struct{}
+	timeout time.Duration
+}
+
+// NewPool creates a pool processing up to concurrency images with queueDepth waiting requests.
+// Requests wait at most timeout for a slot, no limit if zero. Returns nil if concurrency is not positive.
+func NewPool(concurrency, queueDepth int, timeout time.Duration) *Pool {
+	if concurrency <= 0 {
+		return nil
+	}
+	return &Pool{
+		slots:   make(chan struct{}, concurrency),
+		queue:   make(chan struct{}, max(queueDepth, 0)),
+		timeout: timeout,
+	}
+}
+
+// Acquire waits for a processing slot. The returned function releases the slot and must be called once processing is done.
+func (p *Pool) Acquire(ctx context.Context) (func(), error) {
+	if p == nil {
+		return func() {}, nil
+	}
+
+	// Take a free slot right away
+	select {
+	case p.slots <- struct{}{}:
+		return p.release, nil
+	default:
+	}
+
+	// Otherwise wait in the queue if there is room left
+	select {
+	case p.queue <- struct{}{}:
+		defer func() { <-p.queue }()
+	default:
+		return nil, ErrQueueFull
+	}
+
+	var timeout <-chan time.Time
+	if p.timeout > 0 {
+		timer := time.NewTimer(p.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case p.slots <- struct{}{}:
+		return p.release, nil
+	case <-timeout:
+		return nil, ErrQueueTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *Pool) release() {
+	<-p.slots
+}
+
+// InUse returns the number of images being processed
+func (p *Pool) InUse() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.slots)
+}
+
+// Queued returns the number of requests waiting for processing
+func (p *Pool) Queued() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.queue)
+}
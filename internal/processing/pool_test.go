@@ -0,0 +1,75 @@
+package processing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPool(t *testing.T) {
+	pool := NewPool(2, 1, 50*time.Millisecond)
+
+	release1, err := pool.Acquire(context.Background())
+	require.NoError(t, err)
+	release2, err := pool.Acquire(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, pool.InUse())
+
+	// A queued request gets the next free slot
+	acquired := make(chan error)
+	go func() {
+		release, err := pool.Acquire(context.Background())
+		if err == nil {
+			defer release()
+		}
+		acquired <- err
+	}()
+	require.Eventually(t, func() bool { return pool.Queued() == 1 }, time.Second, time.Millisecond)
+
+	// The queue is full
+	_, err = pool.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrQueueFull)
+
+	release1()
+	assert.NoError(t, <-acquired)
+	assert.Equal(t, 0, pool.Queued())
+
+	// Slots are released again
+	release2()
+	assert.Eventually(t, func() bool { return pool.InUse() == 0 }, time.Second, time.Millisecond)
+}
+
+func TestPoolTimeout(t *testing.T) {
+	pool := NewPool(1, 1, 10*time.Millisecond)
+	release, err := pool.Acquire(context.Background())
+	require.NoError(t, err)
+	defer release()
+
+	_, err = pool.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrQueueTimeout)
+
+	// Waiting ends with the request
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = NewPool(1, 1, 0).Acquire(ctx)
+	assert.NoError(t, err, "a free slot is taken regardless of the context")
+	pool = NewPool(1, 1, 0)
+	release, err = pool.Acquire(context.Background())
+	require.NoError(t, err)
+	defer release()
+	_, err = pool.Acquire(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestNilPool(t *testing.T) {
+	pool := NewPool(0, 10, time.Second)
+	assert.Nil(t, pool)
+
+	release, err := pool.Acquire(context.Background())
+	require.NoError(t, err)
+	release()
+	assert.Equal(t, 0, pool.InUse())
+}
@@ -0,0 +1,90 @@
+package processing
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+)
+
+// createGradientImage creates an opaque image with smooth color gradients
+func createGradientImage(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 255 / width), G: uint8(y * 255 / height), B: uint8((x + y) % 256), A: 255})
+		}
+	}
+	return img
+}
+
+func TestPreReduce(t *testing.T) {
+	tests := []struct {
+		name      string
+		srcWidth  int
+		srcHeight int
+		width     int
+		height    int
+		expected  image.Point
+	}{
+		{name: "thumbnail of large image", srcWidth: 6000, srcHeight: 4000, width: 100, height: 100, expected: image.Pt(300, 200)},
+		{name: "covers both dimensions", srcWidth: 4000, srcHeight: 6000, width: 200, height: 100, expected: image.Pt(400, 600)},
+		{name: "small reduction", srcWidth: 1000, srcHeight: 800, width: 300, height: 240, expected: image.Pt(1000, 800)},
+		{name: "reduction of four", srcWidth: 1000, srcHeight: 800, width: 250, height: 200, expected: image.Pt(500, 400)},
+		{name: "missing dimension", srcWidth: 6000, srcHeight: 4000, width: 100, expected: image.Pt(6000, 4000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewNRGBA(image.Rect(0, 0, tt.srcWidth, tt.srcHeight))
+			assert.Equal(t, tt.expected, preReduce(img, tt.width, tt.height).Bounds().Size())
+		})
+	}
+}
+
+func TestResizeImagePreReduce(t *testing.T) {
+	original := createGradientImage(2400, 1600)
+
+	tests := []struct {
+		name     string
+		width    int
+		height   int
+		mode     FitMode
+		expected image.Point
+	}{
+		{name: "fill", width: 100, height: 100, mode: FitFill, expected: image.Pt(100, 100)},
+		{name: "fit", width: 100, height: 100, mode: FitFit, expected: image.Pt(100, 67)},
+		{name: "pad", width: 100, height: 100, mode: FitPad, expected: image.Pt(100, 100)},
+		{name: "stretch", width: 100, height: 300, mode: FitStretch, expected: image.Pt(100, 300)},
+		{name: "limit", width: 100, height: 100, mode: FitLimit, expected: image.Pt(100, 67)},
+		{name: "width only", width: 150, mode: FitFill, expected: image.Pt(150, 100)},
+		{name: "height only", height: 70, mode: FitFill, expected: image.Pt(105, 70)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resized := ResizeImage(original, tt.width, tt.height, tt.mode, Gravity{Anchor: imaging.Center})
+			assert.Equal(t, tt.expected, resized.Bounds().Size(), "pre-reduction must not change the output size")
+		})
+	}
+
+	// The result is visually the same as a single Lanczos pass over the full image
+	direct := imaging.Resize(original, 150, 100, imaging.Lanczos)
+	reduced := imaging.Clone(ResizeImage(original, 150, 0, FitFill, Gravity{}))
+	var diff float64
+	for i := range direct.Pix {
+		diff += math.Abs(float64(direct.Pix[i]) - float64(reduced.Pix[i]))
+	}
+	assert.Less(t, diff/float64(len(direct.Pix)), 2.0, "mean difference per channel")
+}
+
+func BenchmarkResizeImageThumbnail(b *testing.B) {
+	original := createGradientImage(6000, 4000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ResizeImage(original, 100, 100, FitFill, Gravity{Anchor: imaging.Center})
+	}
+}
@@ -1,18 +1,95 @@
 package processing
 
 import (
+	"fmt"
 	"image"
+	"math"
+	"strings"
 
 	"github.com/disintegration/imaging"
 )
 
-func ResizeImage(img image.Image, width, height int) image.Image {
-	// Resize image
-	if width > 0 && height > 0 {
-		img = imaging.Fill(img, width, height, imaging.Center, imaging.Lanczos)
-	} else if width > 0 || height > 0 {
-		img = imaging.Resize(img, width, height, imaging.Lanczos)
+type FitMode string
+
+const (
+	// FitFill scales and center crops the image to cover the whole box
+	FitFill FitMode = "fill"
+	// FitFit scales the image to fit completely into the box
+	FitFit FitMode = "fit"
+	// FitPad fits the image into the box and letterboxes the remaining area with transparency
+	FitPad FitMode = "pad"
+	// FitStretch scales the image to the box ignoring its aspect ratio
+	FitStretch FitMode = "stretch"
+	// FitLimit fits the image into the box but never upscales it
+	FitLimit FitMode = "limit"
+)
+
+// ParseFitMode maps a fit mode name to its FitMode
+func ParseFitMode(name string) (FitMode, error) {
+	switch mode := FitMode(strings.ToLower(name)); mode {
+	case FitFill, FitFit, FitPad, FitStretch, FitLimit:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported fit mode %q", name)
+	}
+}
+
+// ResizeImage scales the image into the box according to the fit mode.
+// Large images are pre-reduced to about twice the output size with a fast filter before the final Lanczos pass.
+func ResizeImage(img image.Image, width, height int, mode FitMode, gravity Gravity) image.Image {
+	if (width <= 0 && height <= 0) || img.Bounds().Empty() {
+		return img
+	}
+	srcWidth, srcHeight := img.Bounds().Dx(), img.Bounds().Dy()
+
+	// Only one dimension given - scale proportionally
+	if width <= 0 || height <= 0 {
+		if mode == FitLimit && (width > srcWidth || height > srcHeight) {
+			return img
+		}
+		w, h := proportionalDimensions(srcWidth, srcHeight, width, height)
+		return imaging.Resize(preReduce(img, w, h), w, h, imaging.Lanczos)
 	}
 
-	return img
+	switch mode {
+	case FitFit:
+		w, h := fitDimensions(srcWidth, srcHeight, width, height)
+		return imaging.Resize(preReduce(img, w, h), w, h, imaging.Lanczos)
+	case FitPad:
+		w, h := fitDimensions(srcWidth, srcHeight, width, height)
+		// Letterbox on a transparent canvas - the background is filled in afterwards
+		canvas := imaging.New(width, height, image.Transparent)
+		return imaging.PasteCenter(canvas, imaging.Resize(preReduce(img, w, h), w, h, imaging.Lanczos))
+	case FitStretch:
+		return imaging.Resize(preReduce(img, width, height), width, height, imaging.Lanczos)
+	case FitLimit:
+		if srcWidth <= width && srcHeight <= height {
+			return imaging.Clone(img)
+		}
+		// Larger images are downscaled like with FitFit
+		w, h := fitDimensions(srcWidth, srcHeight, width, height)
+		return imaging.Resize(preReduce(img, w, h), w, h, imaging.Lanczos)
+	default:
+		// The pre-reduced image still covers the box, so the crop keeps its position
+		return fillImage(preReduce(img, width, height), width, height, gravity)
+	}
+}
+
+// fitDimensions returns the largest size with the source aspect ratio fitting into the box
+func fitDimensions(srcWidth, srcHeight, width, height int) (int, int) {
+	scale := math.Min(float64(width)/float64(srcWidth), float64(height)/float64(srcHeight))
+	w := int(math.Max(1, math.Round(float64(srcWidth)*scale)))
+	h := int(math.Max(1, math.Round(float64(srcHeight)*scale)))
+	return w, h
+}
+
+// proportionalDimensions completes a missing dimension from the source aspect ratio like imaging.Resize
+func proportionalDimensions(srcWidth, srcHeight, width, height int) (int, int) {
+	if width == 0 {
+		width = int(math.Max(1, math.Floor(float64(height)*float64(srcWidth)/float64(srcHeight)+0.5)))
+	}
+	if height == 0 {
+		height = int(math.Max(1, math.Floor(float64(width)*float64(srcHeight)/float64(srcWidth)+0.5)))
+	}
+	return width, height
 }
@@ -3,6 +3,7 @@ package processing
 import (
 	"image"
 	"image/color"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -78,7 +79,7 @@ func TestResizeImage(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Resize the image
-			resized := ResizeImage(original, tt.width, tt.height)
+			resized := ResizeImage(original, tt.width, tt.height, FitFill, Gravity{})
 
 			// Check dimensions
 			bounds := resized.Bounds()
@@ -142,7 +143,7 @@ func TestResizeImageWithDifferentAspectRatios(t *testing.T) {
 			original := createTestImage(tt.originalWidth, tt.originalHeight, color.RGBA{R: 255, G: 0, B: 0, A: 255})
 
 			// Resize the image
-			resized := ResizeImage(original, tt.targetWidth, tt.targetHeight)
+			resized := ResizeImage(original, tt.targetWidth, tt.targetHeight, FitFill, Gravity{})
 
 			// Check dimensions
 			bounds := resized.Bounds()
@@ -151,3 +152,157 @@ func TestResizeImageWithDifferentAspectRatios(t *testing.T) {
 		})
 	}
 }
+
+func TestResizeImageFitModes(t *testing.T) {
+	tests := []struct {
+		name           string
+		originalWidth  int
+		originalHeight int
+		targetWidth    int
+		targetHeight   int
+		mode           FitMode
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{
+			name:           "fill crops to box",
+			originalWidth:  200,
+			originalHeight: 100,
+			targetWidth:    100,
+			targetHeight:   100,
+			mode:           FitFill,
+			expectedWidth:  100,
+			expectedHeight: 100,
+		},
+		{
+			name:           "fit keeps whole landscape image",
+			originalWidth:  200,
+			originalHeight: 100,
+			targetWidth:    100,
+			targetHeight:   100,
+			mode:           FitFit,
+			expectedWidth:  100,
+			expectedHeight: 50,
+		},
+		{
+			name:           "fit keeps whole portrait image",
+			originalWidth:  100,
+			originalHeight: 200,
+			targetWidth:    100,
+			targetHeight:   100,
+			mode:           FitFit,
+			expectedWidth:  50,
+			expectedHeight: 100,
+		},
+		{
+			name:           "fit upscales",
+			originalWidth:  50,
+			originalHeight: 25,
+			targetWidth:    200,
+			targetHeight:   200,
+			mode:           FitFit,
+			expectedWidth:  200,
+			expectedHeight: 100,
+		},
+		{
+			name:           "pad fills box",
+			originalWidth:  200,
+			originalHeight: 100,
+			targetWidth:    100,
+			targetHeight:   100,
+			mode:           FitPad,
+			expectedWidth:  100,
+			expectedHeight: 100,
+		},
+		{
+			name:           "stretch ignores aspect ratio",
+			originalWidth:  200,
+			originalHeight: 100,
+			targetWidth:    100,
+			targetHeight:   100,
+			mode:           FitStretch,
+			expectedWidth:  100,
+			expectedHeight: 100,
+		},
+		{
+			name:           "limit scales down",
+			originalWidth:  200,
+			originalHeight: 100,
+			targetWidth:    100,
+			targetHeight:   100,
+			mode:           FitLimit,
+			expectedWidth:  100,
+			expectedHeight: 50,
+		},
+		{
+			name:           "limit never upscales",
+			originalWidth:  50,
+			originalHeight: 25,
+			targetWidth:    200,
+			targetHeight:   200,
+			mode:           FitLimit,
+			expectedWidth:  50,
+			expectedHeight: 25,
+		},
+		{
+			name:           "limit never upscales single dimension",
+			originalWidth:  50,
+			originalHeight: 25,
+			targetWidth:    200,
+			targetHeight:   0,
+			mode:           FitLimit,
+			expectedWidth:  50,
+			expectedHeight: 25,
+		},
+		{
+			name:           "fit with single dimension",
+			originalWidth:  200,
+			originalHeight: 100,
+			targetWidth:    0,
+			targetHeight:   50,
+			mode:           FitFit,
+			expectedWidth:  100,
+			expectedHeight: 50,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := createTestImage(tt.originalWidth, tt.originalHeight, color.RGBA{R: 255, G: 0, B: 0, A: 255})
+
+			resized := ResizeImage(original, tt.targetWidth, tt.targetHeight, tt.mode, Gravity{})
+
+			bounds := resized.Bounds()
+			assert.Equal(t, tt.expectedWidth, bounds.Dx(), "width should match expected")
+			assert.Equal(t, tt.expectedHeight, bounds.Dy(), "height should match expected")
+		})
+	}
+}
+
+func TestResizeImagePadLetterbox(t *testing.T) {
+	// Fully opaque landscape image padded into a square box
+	original := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			original.Set(x, y, color.RGBA{R: 255, G: 0, B: 0, A: 255})
+		}
+	}
+
+	padded := ResizeImage(original, 100, 100, FitPad, Gravity{})
+
+	// Letterbox above and below the image stays transparent for the background fill
+	assertColorEqual(t, color.RGBA{}, padded.At(50, 5), "letterbox should be transparent")
+	assertColorEqual(t, color.RGBA{}, padded.At(50, 95), "letterbox should be transparent")
+	assertColorEqual(t, color.RGBA{R: 255, G: 0, B: 0, A: 255}, padded.At(50, 50), "image should be centered")
+}
+
+func TestParseFitMode(t *testing.T) {
+	for _, name := range []string{"fill", "fit", "pad", "stretch", "limit", "FIT"} {
+		mode, err := ParseFitMode(name)
+		assert.NoError(t, err)
+		assert.Equal(t, FitMode(strings.ToLower(name)), mode)
+	}
+
+	_, err := ParseFitMode("crop")
+	assert.Error(t, err)
+}
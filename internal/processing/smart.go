@@ -0,0 +1,114 @@
+package processing
+
+import (
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	// smartAnalysisSize is the longest side of the downscaled copy used to score crop windows
+	smartAnalysisSize = 256
+	// smartCandidates is the maximum number of crop windows scored along the free axis
+	smartCandidates = 32
+	// smartHistogramBins is the number of luminance bins used for the entropy score
+	smartHistogramBins = 32
+)
+
+// smartFocalPoint scores crop windows with the target aspect ratio by edge density and
+// luminance entropy and returns the center of the most interesting window as focal point
+func smartFocalPoint(img image.Image, width, height int) Gravity {
+	// Analyse a small grayscale copy - the scores do not need full resolution
+	analysis := imaging.Grayscale(imaging.Fit(img, smartAnalysisSize, smartAnalysisSize, imaging.Box))
+	w, h := analysis.Bounds().Dx(), analysis.Bounds().Dy()
+	cropWidth, cropHeight := cropDimensions(w, h, width, height)
+
+	free := max(w-cropWidth, h-cropHeight)
+	if free <= 0 {
+		return Gravity{}
+	}
+
+	luma := make([]uint8, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			luma[y*w+x] = analysis.Pix[y*analysis.Stride+x*4]
+		}
+	}
+	edges := integralImage(edgeMagnitudes(luma, w, h), w, h)
+
+	step := max(1, free/smartCandidates)
+	bestScore, bestOffset := -1.0, free/2
+	for offset := 0; offset <= free; offset += step {
+		window := image.Rect(0, offset, cropWidth, offset+cropHeight)
+		if cropWidth < w {
+			window = image.Rect(offset, 0, offset+cropWidth, cropHeight)
+		}
+
+		score := edgeDensity(edges, w, window) + windowEntropy(luma, w, window)
+		if score > bestScore {
+			bestScore, bestOffset = score, offset
+		}
+	}
+
+	if cropWidth < w {
+		return Gravity{Focal: true, X: (float64(bestOffset) + float64(cropWidth)/2) / float64(w), Y: 0.5}
+	}
+	return Gravity{Focal: true, X: 0.5, Y: (float64(bestOffset) + float64(cropHeight)/2) / float64(h)}
+}
+
+// edgeMagnitudes returns the Sobel gradient magnitude of each pixel scaled to 0..1
+func edgeMagnitudes(luma []uint8, w, h int) []float64 {
+	at := func(x, y int) float64 {
+		return float64(luma[clamp(y, 0, h-1)*w+clamp(x, 0, w-1)])
+	}
+
+	edges := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+			edges[y*w+x] = math.Min(1, math.Hypot(gx, gy)/(4*255))
+		}
+	}
+	return edges
+}
+
+// integralImage returns the summed area table with an extra leading row and column of zeros
+func integralImage(values []float64, w, h int) []float64 {
+	sums := make([]float64, (w+1)*(h+1))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sums[(y+1)*(w+1)+x+1] = values[y*w+x] + sums[y*(w+1)+x+1] + sums[(y+1)*(w+1)+x] - sums[y*(w+1)+x]
+		}
+	}
+	return sums
+}
+
+// edgeDensity returns the mean edge magnitude inside the window
+func edgeDensity(sums []float64, w int, window image.Rectangle) float64 {
+	stride := w + 1
+	total := sums[window.Max.Y*stride+window.Max.X] - sums[window.Min.Y*stride+window.Max.X] -
+		sums[window.Max.Y*stride+window.Min.X] + sums[window.Min.Y*stride+window.Min.X]
+	return total / float64(window.Dx()*window.Dy())
+}
+
+// windowEntropy returns the Shannon entropy of the luminance histogram inside the window scaled to 0..1
+func windowEntropy(luma []uint8, w int, window image.Rectangle) float64 {
+	var histogram [smartHistogramBins]int
+	for y := window.Min.Y; y < window.Max.Y; y++ {
+		for x := window.Min.X; x < window.Max.X; x++ {
+			histogram[int(luma[y*w+x])*smartHistogramBins/256]++
+		}
+	}
+
+	total := float64(window.Dx() * window.Dy())
+	entropy := 0.0
+	for _, count := range histogram {
+		if count > 0 {
+			p := float64(count) / total
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy / math.Log2(smartHistogramBins)
+}
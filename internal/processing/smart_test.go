@@ -0,0 +1,102 @@
+package processing
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createDetailImage creates a flat gray image with a checkerboard patch in the given region
+func createDetailImage(width, height int, detail image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{R: 128, G: 128, B: 128, A: 255}
+			if (image.Point{X: x, Y: y}).In(detail) && (x/4+y/4)%2 == 0 {
+				c = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+			} else if (image.Point{X: x, Y: y}).In(detail) {
+				c = color.RGBA{A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestSmartFocalPoint(t *testing.T) {
+	tests := []struct {
+		name   string
+		width  int
+		height int
+		detail image.Rectangle
+		checkX bool
+		min    float64
+		max    float64
+	}{
+		{
+			name:   "detail on the right of landscape image",
+			width:  400,
+			height: 100,
+			detail: image.Rect(300, 0, 400, 100),
+			checkX: true,
+			min:    0.7,
+			max:    1.0,
+		},
+		{
+			name:   "detail on the left of landscape image",
+			width:  400,
+			height: 100,
+			detail: image.Rect(0, 0, 100, 100),
+			checkX: true,
+			min:    0.0,
+			max:    0.3,
+		},
+		{
+			name:   "detail at the top of portrait image",
+			width:  100,
+			height: 400,
+			detail: image.Rect(0, 0, 100, 100),
+			min:    0.0,
+			max:    0.3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := createDetailImage(tt.width, tt.height, tt.detail)
+
+			gravity := smartFocalPoint(img, 100, 100)
+
+			assert.True(t, gravity.Focal, "smart crop should yield a focal point")
+			value := gravity.Y
+			if tt.checkX {
+				value = gravity.X
+			}
+			assert.GreaterOrEqual(t, value, tt.min)
+			assert.LessOrEqual(t, value, tt.max)
+		})
+	}
+}
+
+func TestSmartFocalPointMatchingAspectRatio(t *testing.T) {
+	img := createDetailImage(100, 100, image.Rect(0, 0, 50, 50))
+
+	gravity := smartFocalPoint(img, 200, 200)
+
+	assert.Equal(t, Gravity{}, gravity, "nothing to crop should fall back to center")
+}
+
+func TestResizeImageWithSmartGravity(t *testing.T) {
+	img := createDetailImage(400, 100, image.Rect(300, 0, 400, 100))
+
+	resized := ResizeImage(img, 50, 50, FitFill, Gravity{Smart: true})
+
+	assert.Equal(t, 50, resized.Bounds().Dx(), "width should match expected")
+	assert.Equal(t, 50, resized.Bounds().Dy(), "height should match expected")
+
+	// The flat gray area must have been cropped away
+	r, g, b, _ := resized.At(25, 25).RGBA()
+	assert.False(t, r == g && g == b && r>>8 == 128, "detail region should be kept")
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spossner/img-sizer/internal/config"
+)
+
+// Backend loads source objects from a storage system
+type Backend interface {
+	// GetObject returns the content of the object, the caller has to close the body
+	GetObject(ctx context.Context, bucket, key string) (*Object, error)
+	// HeadObject returns the metadata of the object without its content
+	HeadObject(ctx context.Context, bucket, key string) (*ObjectInfo, error)
+	// CheckHealth reports whether the storage system is reachable
+	CheckHealth(ctx context.Context) error
+}
+
+// Writer stores objects in a storage system
+type Writer interface {
+	// PutObject stores the data with the content type and metadata of info, other fields are set by the storage
+	PutObject(ctx context.Context, bucket, key string, data []byte, info ObjectInfo) error
+}
+
+// ObjectInfo is the metadata of a stored object
+type ObjectInfo struct {
+	// ContentLength is the size of the body in bytes or -1 if unknown
+	ContentLength int64
+	ETag          string
+	LastModified  time.Time
+	ContentType   string
+	// Metadata holds user defined metadata, keys are lower case
+	Metadata map[string]string
+}
+
+// Object is the content of a stored object with its metadata
+type Object struct {
+	ObjectInfo
+	Body io.ReadCloser
+}
+
+// Backends resolves the storage backend of each allowed source
+type Backends struct {
+	// s3 is the pool of S3 clients, sources with the same settings share their client
+	s3 map[S3Options]Backend
+	fs map[string]Backend
+}
+
+// NewBackends creates the backends used by the given sources. S3 clients are only created
+// if at least one source is loaded from S3, so setups serving from the filesystem need no AWS credentials.
+func NewBackends(ctx context.Context, s3Cfg config.S3, sources []config.SourceConfig) (*Backends, error) {
+	backends := &Backends{s3: make(map[S3Options]Backend), fs: make(map[string]Backend)}
+	clients := make(map[S3Options]*S3Client)
+	for _, source := range sources {
+		if source.IsFS() {
+			if _, ok := backends.fs[source.Root]; ok {
+				continue
+			}
+			backend, err := NewFSBackend(source.Root)
+			if err != nil {
+				return nil, err
+			}
+			backends.fs[source.Root] = backend
+			continue
+		}
+
+		if source.Bucket == "" && source.Matcher == nil {
+			continue
+		}
+		opts := s3Options(&source)
+		client, ok := clients[opts]
+		if !ok {
+			var err error
+			if client, err = NewS3Client(ctx, s3Cfg, opts); err != nil {
+				return nil, err
+			}
+			clients[opts] = client
+			backends.s3[opts] = client
+		}
+		client.addBucket(source.Bucket)
+	}
+	return backends, nil
+}
+
+// For returns the backend to load the bucket of the source from or nil if the source URL has to be fetched directly
+func (b *Backends) For(source *config.SourceConfig, bucket string) Backend {
+	if source.IsFS() {
+		return b.fs[source.Root]
+	}
+	if bucket != "" {
+		return b.s3[s3Options(source)]
+	}
+	return nil
+}
+
+// CheckHealth checks all backends and returns their combined errors
+func (b *Backends) CheckHealth(ctx context.Context) error {
+	var errs []error
+	for opts, backend := range b.s3 {
+		if err := backend.CheckHealth(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", opts, err))
+		}
+	}
+	for root, backend := range b.fs {
+		if err := backend.CheckHealth(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", root, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// s3Options returns the settings of the S3 client used by the source
+func s3Options(source *config.SourceConfig) S3Options {
+	return S3Options{
+		Region:        source.Region,
+		Endpoint:      source.Endpoint,
+		Profile:       source.Profile,
+		AssumeRoleARN: source.AssumeRoleARN,
+	}
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/spossner/img-sizer/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackendsFor(t *testing.T) {
+	root := t.TempDir()
+	fsSource := config.SourceConfig{Backend: config.BackendFS, Root: root}
+	s3Source := config.SourceConfig{Bucket: "images"}
+	urlSource := config.SourceConfig{}
+
+	// Without S3 sources no S3 client and no AWS credentials are needed
+	backends, err := NewBackends(context.Background(), config.S3{}, []config.SourceConfig{fsSource, fsSource, urlSource})
+	require.NoError(t, err)
+	assert.Len(t, backends.fs, 1, "sources sharing a root should share the backend")
+	assert.Empty(t, backends.s3)
+
+	backends.s3[S3Options{}] = &S3Client{}
+
+	assert.IsType(t, &FSBackend{}, backends.For(&fsSource, ""))
+	assert.IsType(t, &FSBackend{}, backends.For(&fsSource, "bucket"))
+	assert.IsType(t, &S3Client{}, backends.For(&s3Source, "images"))
+	assert.Nil(t, backends.For(&urlSource, ""))
+}
+
+func TestBackendsS3ClientPool(t *testing.T) {
+	// Credentials are resolved on first use, so no AWS credentials are needed to create the clients
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+
+	defaultSource := config.SourceConfig{Bucket: "images"}
+	roleSource := config.SourceConfig{Bucket: "other", AssumeRoleARN: "arn:aws:iam::123456789012:role/img-sizer"}
+	matcherSource := config.SourceConfig{Matcher: regexp.MustCompile(`^https://([^.]+)\.example\.com/(.+)$`)}
+
+	usSource := config.SourceConfig{Bucket: "us-images", Region: "us-east-1"}
+	usOtherSource := config.SourceConfig{Bucket: "us-other", Region: "us-east-1"}
+
+	backends, err := NewBackends(context.Background(), config.S3{}, []config.SourceConfig{defaultSource, roleSource, matcherSource, usSource, usOtherSource})
+	require.NoError(t, err)
+	assert.Len(t, backends.s3, 3, "sources with the same settings should share the client")
+
+	assert.Same(t, backends.For(&defaultSource, "images"), backends.For(&matcherSource, "matched"))
+	assert.NotSame(t, backends.For(&defaultSource, "images"), backends.For(&roleSource, "other"))
+	assert.NotSame(t, backends.For(&defaultSource, "images"), backends.For(&usSource, "us-images"))
+	assert.Same(t, backends.For(&usSource, "us-images"), backends.For(&usOtherSource, "us-other"))
+
+	// Each client checks the buckets of its sources for health
+	assert.Equal(t, []string{"us-images", "us-other"}, backends.For(&usSource, "us-images").(*S3Client).buckets)
+	assert.Equal(t, []string{"images"}, backends.For(&matcherSource, "matched").(*S3Client).buckets, "matched buckets are not known")
+}
+
+func TestBackendsCheckHealth(t *testing.T) {
+	backends, err := NewBackends(context.Background(), config.S3{}, []config.SourceConfig{
+		{Backend: config.BackendFS, Root: t.TempDir()},
+	})
+	require.NoError(t, err)
+
+	assert.NoError(t, backends.CheckHealth(context.Background()))
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+)
+
+// FSBackend serves objects from a directory of the local filesystem
+type FSBackend struct {
+	dir  string
+	root *os.Root
+}
+
+// NewFSBackend creates a backend serving the files below dir. The bucket is used as subdirectory,
+// paths escaping dir are rejected.
+func NewFSBackend(dir string) (*FSBackend, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error opening storage root: %w", err)
+	}
+	return &FSBackend{dir: dir, root: root}, nil
+}
+
+// GetObject opens the file of the object
+func (b *FSBackend) GetObject(ctx context.Context, bucket, key string) (*Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	file, err := b.root.Open(objectPath(bucket, key))
+	if err != nil {
+		return nil, fmt.Errorf("error opening object: %w", err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error reading object info: %w", err)
+	}
+	if !stat.Mode().IsRegular() {
+		file.Close()
+		return nil, fmt.Errorf("error opening object: %s is not a regular file", key)
+	}
+
+	return &Object{
+		ObjectInfo: fileInfo(stat),
+		Body:       file,
+	}, nil
+}
+
+// HeadObject returns the metadata of the file of the object
+func (b *FSBackend) HeadObject(ctx context.Context, bucket, key string) (*ObjectInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	stat, err := b.root.Stat(objectPath(bucket, key))
+	if err != nil {
+		return nil, fmt.Errorf("error reading object info: %w", err)
+	}
+	if !stat.Mode().IsRegular() {
+		return nil, fmt.Errorf("error reading object info: %s is not a regular file", key)
+	}
+
+	info := fileInfo(stat)
+	return &info, nil
+}
+
+// CheckHealth checks that the root directory is still accessible by its path, e.g. the volume is still mounted
+func (b *FSBackend) CheckHealth(ctx context.Context) error {
+	stat, err := os.Stat(b.dir)
+	if err != nil {
+		return fmt.Errorf("error accessing storage root: %w", err)
+	}
+	if !stat.IsDir() {
+		return fmt.Errorf("storage root %s is not a directory", b.dir)
+	}
+	return nil
+}
+
+// objectPath returns the path of the object relative to the root
+func objectPath(bucket, key string) string {
+	return path.Join(bucket, key)
+}
+
+// fileInfo derives the object metadata from the file, the ETag is built from modification time and size
+func fileInfo(stat fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		ContentLength: stat.Size(),
+		ETag:          fmt.Sprintf(`"%x-%x"`, stat.ModTime().UnixNano(), stat.Size()),
+		LastModified:  stat.ModTime().UTC(),
+	}
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createFSBackend creates a backend on a temporary directory with the given files
+func createFSBackend(t *testing.T, files map[string]string) (*FSBackend, string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	backend, err := NewFSBackend(dir)
+	require.NoError(t, err)
+	return backend, dir
+}
+
+func TestFSBackendGetObject(t *testing.T) {
+	backend, _ := createFSBackend(t, map[string]string{
+		"images/test.jpg":     "image data",
+		"bucket/images/b.jpg": "bucket data",
+		"images/nested/c.jpg": "nested data",
+	})
+
+	tests := []struct {
+		name     string
+		bucket   string
+		key      string
+		expected string
+		wantErr  bool
+	}{
+		{name: "file in root", key: "images/test.jpg", expected: "image data"},
+		{name: "bucket as subdirectory", bucket: "bucket", key: "images/b.jpg", expected: "bucket data"},
+		{name: "nested file", key: "images/nested/c.jpg", expected: "nested data"},
+		{name: "missing file", key: "images/missing.jpg", wantErr: true},
+		{name: "directory", key: "images", wantErr: true},
+		{name: "path traversal", key: "../../etc/passwd", wantErr: true},
+		{name: "path traversal through bucket", bucket: "..", key: "etc/passwd", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			object, err := backend.GetObject(context.Background(), tt.bucket, tt.key)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer object.Body.Close()
+
+			data, err := io.ReadAll(object.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(data))
+			assert.Equal(t, int64(len(tt.expected)), object.ContentLength)
+			assert.NotEmpty(t, object.ETag)
+			assert.False(t, object.LastModified.IsZero())
+		})
+	}
+}
+
+func TestFSBackendHeadObject(t *testing.T) {
+	backend, dir := createFSBackend(t, map[string]string{"test.jpg": "image data"})
+
+	info, err := backend.HeadObject(context.Background(), "", "test.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), info.ContentLength)
+
+	// The ETag changes with the file
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "test.jpg"), []byte("other image data"), 0o644))
+	changed, err := backend.HeadObject(context.Background(), "", "test.jpg")
+	require.NoError(t, err)
+	assert.NotEqual(t, info.ETag, changed.ETag)
+
+	_, err = backend.HeadObject(context.Background(), "", "missing.jpg")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestFSBackendCheckHealth(t *testing.T) {
+	backend, dir := createFSBackend(t, nil)
+	assert.NoError(t, backend.CheckHealth(context.Background()))
+
+	require.NoError(t, os.Remove(dir))
+	assert.Error(t, backend.CheckHealth(context.Background()))
+}
+
+func TestNewFSBackendMissingRoot(t *testing.T) {
+	_, err := NewFSBackend(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/spossner/img-sizer/internal/config"
+)
+
+// HTTPFetcher loads source images from origin URLs
+type HTTPFetcher struct {
+	client    *http.Client
+	userAgent string
+}
+
+// NewHTTPFetcher creates a new HTTP fetcher with the timeouts and redirect limit of the given config.
+// Connections to private, loopback and link-local addresses are rejected unless their network is allowed
+// explicitly, and every redirect target must pass allowHost.
+func NewHTTPFetcher(cfg config.HTTPSource, allowHost func(host string) bool) *HTTPFetcher {
+	dialer := &net.Dialer{
+		Timeout:   cfg.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+		Control:   dialControl(cfg.AllowedNetworks),
+	}
+
+	// No proxy support - the address check must see the origin address
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: cfg.TLSTimeout,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   cfg.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > cfg.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", cfg.MaxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("%w: redirect to scheme %s", ErrForbiddenAddress, req.URL.Scheme)
+			}
+			if !allowHost(req.URL.Host) {
+				return fmt.Errorf("%w: redirect to host %s", ErrForbiddenAddress, req.URL.Host)
+			}
+			return nil
+		},
+	}
+
+	return &HTTPFetcher{client: client, userAgent: cfg.UserAgent}
+}
+
+// Get requests the URL and returns the response body, the request is canceled with the context
+func (f *HTTPFetcher) Get(ctx context.Context, url string) (*Object, error) {
+	resp, err := f.do(ctx, http.MethodGet, url)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Object{
+		ObjectInfo: responseInfo(resp),
+		Body:       resp.Body,
+	}, nil
+}
+
+// Head requests the headers of the URL without the body
+func (f *HTTPFetcher) Head(ctx context.Context, url string) (*ObjectInfo, error) {
+	resp, err := f.do(ctx, http.MethodHead, url)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	info := responseInfo(resp)
+	return &info, nil
+}
+
+// do sends the request and rejects responses other than 200 OK
+func (f *HTTPFetcher) do(ctx context.Context, method, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	if f.userAgent != "" {
+		req.Header.Set("User-Agent", f.userAgent)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting %s: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %d requesting %s", resp.StatusCode, url)
+	}
+	return resp, nil
+}
+
+// responseInfo returns the metadata of the response
+func responseInfo(resp *http.Response) ObjectInfo {
+	info := ObjectInfo{
+		ContentLength: resp.ContentLength,
+		ETag:          resp.Header.Get("ETag"),
+		ContentType:   resp.Header.Get("Content-Type"),
+	}
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.LastModified = lastModified
+	}
+	return info
+}
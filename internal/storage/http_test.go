@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spossner/img-sizer/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestFetcher creates a fetcher allowed to connect to the loopback test servers
+func newTestFetcher(allowHost func(host string) bool) *HTTPFetcher {
+	return NewHTTPFetcher(config.HTTPSource{
+		ConnectTimeout:  time.Second,
+		TLSTimeout:      time.Second,
+		Timeout:         500 * time.Millisecond,
+		MaxRedirects:    2,
+		UserAgent:       "Image-Sizer-Test",
+		AllowedNetworks: mustParseCIDRs("127.0.0.0/8", "::1/128"),
+	}, allowHost)
+}
+
+func allowAllHosts(host string) bool {
+	return true
+}
+
+func TestHTTPFetcherGet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image":
+			_, _ = w.Write([]byte(r.UserAgent()))
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+		case "/redirect/1":
+			http.Redirect(w, r, "/image", http.StatusFound)
+		case "/redirect/2":
+			http.Redirect(w, r, "/redirect/1", http.StatusFound)
+		case "/redirect/3":
+			http.Redirect(w, r, "/redirect/2", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	fetcher := newTestFetcher(allowAllHosts)
+
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+		wantErr  bool
+	}{
+		{name: "sends user agent", path: "/image", expected: "Image-Sizer-Test"},
+		{name: "follows redirects within limit", path: "/redirect/2", expected: "Image-Sizer-Test"},
+		{name: "stops after redirect limit", path: "/redirect/3", wantErr: true},
+		{name: "non OK status", path: "/missing", wantErr: true},
+		{name: "total timeout", path: "/slow", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			object, err := fetcher.Get(context.Background(), server.URL+tt.path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			defer object.Body.Close()
+
+			body, err := io.ReadAll(object.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(body))
+			assert.Equal(t, int64(len(tt.expected)), object.ContentLength)
+		})
+	}
+}
+
+func TestHTTPFetcherGetCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := newTestFetcher(allowAllHosts).Get(ctx, server.URL)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 400*time.Millisecond, "request should stop with the context")
+}
+
+func TestHTTPFetcherRejectsPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("internal"))
+	}))
+	defer server.Close()
+
+	// Without the loopback override the test server must not be reachable
+	fetcher := NewHTTPFetcher(config.HTTPSource{Timeout: time.Second, MaxRedirects: 2}, allowAllHosts)
+
+	_, err := fetcher.Get(context.Background(), server.URL)
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+}
+
+func TestHTTPFetcherRevalidatesRedirects(t *testing.T) {
+	var target *httptest.Server
+	target = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/other-host":
+			// Same server, but addressed by a host name that is not allowed
+			targetURL, _ := url.Parse(target.URL)
+			http.Redirect(w, r, "http://localhost:"+targetURL.Port()+"/image", http.StatusFound)
+		case "/file":
+			http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+		default:
+			_, _ = w.Write([]byte("image"))
+		}
+	}))
+	defer target.Close()
+
+	allowLoopbackIP := func(host string) bool {
+		return strings.HasPrefix(host, "127.0.0.1")
+	}
+	fetcher := newTestFetcher(allowLoopbackIP)
+
+	_, err := fetcher.Get(context.Background(), target.URL+"/other-host")
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+
+	_, err = fetcher.Get(context.Background(), target.URL+"/file")
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+
+	object, err := fetcher.Get(context.Background(), target.URL+"/image")
+	assert.NoError(t, err)
+	object.Body.Close()
+}
+
+func TestHTTPFetcherHead(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.Equal(t, http.MethodHead, r.Method)
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Last-Modified", "Sat, 01 Mar 2025 12:00:00 GMT")
+	}))
+	defer server.Close()
+
+	fetcher := newTestFetcher(allowAllHosts)
+
+	info, err := fetcher.Head(context.Background(), server.URL+"/image")
+	assert.NoError(t, err)
+	assert.Equal(t, `"abc"`, info.ETag)
+	assert.Equal(t, "image/jpeg", info.ContentType)
+	assert.Equal(t, time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC), info.LastModified)
+
+	_, err = fetcher.Head(context.Background(), server.URL+"/missing")
+	assert.Error(t, err)
+}
@@ -1,59 +1,118 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"fmt"
-	"io"
+	"net/http"
 	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spossner/img-sizer/internal/config"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	awsConfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
-// S3Client handles S3 operations
+// S3Client is the backend loading objects from S3
 type S3Client struct {
 	client *s3.Client
+	// assumesRole is set for clients of other accounts, which usually may not list all buckets
+	assumesRole bool
+	// buckets are the buckets of the sources using the client, they are checked for health
+	buckets []string
 }
 
-// NewS3Client creates a new S3 client using environment credentials
-func NewS3Client(ctx context.Context) (*S3Client, error) {
-	// Get AWS configuration from environment variables
-	accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
-	secretAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+// S3Options selects the account, region and endpoint of an S3 client, empty values use the defaults
+type S3Options struct {
+	Region        string
+	Endpoint      string
+	Profile       string
+	AssumeRoleARN string
+}
 
-	// Validate required environment variables
-	if accessKeyID == "" || secretAccessKey == "" {
-		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+// String returns the non-empty options for logging
+func (o S3Options) String() string {
+	var parts []string
+	for _, option := range []struct{ name, value string }{
+		{"region", o.Region},
+		{"endpoint", o.Endpoint},
+		{"profile", o.Profile},
+		{"role", o.AssumeRoleARN},
+	} {
+		if option.value != "" {
+			parts = append(parts, option.name+"="+option.value)
+		}
+	}
+	if len(parts) == 0 {
+		return "default"
 	}
+	return strings.Join(parts, ",")
+}
 
-	region := os.Getenv("AWS_REGION")
+// NewS3Client creates a new S3 client. Credentials are taken from the SDK default chain, i.e. the
+// environment, shared profiles, web identity (IRSA) or container and instance roles, or from the
+// shared config profile of the options. If a role is set, the client assumes this role with these
+// credentials, e.g. for buckets of other accounts.
+// The endpoint of the options replaces the configured one, which defaults to AWS_ENDPOINT_URL if set
+// and allows S3 compatible stores like MinIO.
+func NewS3Client(ctx context.Context, cfg config.S3, opts S3Options) (*S3Client, error) {
+	region := opts.Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
 	if region == "" {
 		region = "eu-central-1" // Default region if not set
 	}
 
-	creds := credentials.NewStaticCredentialsProvider(
-		accessKeyID,
-		secretAccessKey,
-		"",
-	)
-
-	awsCfg, err := awsConfig.LoadDefaultConfig(
-		ctx,
+	options := []func(*awsConfig.LoadOptions) error{
 		awsConfig.WithRegion(region),
-		awsConfig.WithCredentialsProvider(creds),
-	)
+	}
+	if cfg.InsecureSkipVerify {
+		// Only meant for development against self-signed certificates
+		httpClient := awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+			tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		})
+		options = append(options, awsConfig.WithHTTPClient(httpClient))
+	}
+	if opts.Profile != "" {
+		options = append(options, awsConfig.WithSharedConfigProfile(opts.Profile))
+	}
+
+	awsCfg, err := awsConfig.LoadDefaultConfig(ctx, options...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to load SDK config: %v", err)
 	}
 
-	client := s3.NewFromConfig(awsCfg)
-	return &S3Client{client: client}, nil
+	if opts.AssumeRoleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(awsCfg), opts.AssumeRoleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = "img-sizer"
+		})
+		awsCfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+
+	endpoint := cfg.Endpoint
+	if opts.Endpoint != "" {
+		endpoint = opts.Endpoint
+	}
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+		o.UsePathStyle = cfg.UsePathStyle
+	})
+	return &S3Client{client: client, assumesRole: opts.AssumeRoleARN != ""}, nil
 }
 
 // GetObject retrieves an object from S3
-func (c *S3Client) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+func (c *S3Client) GetObject(ctx context.Context, bucket, key string) (*Object, error) {
 	input := &s3.GetObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
@@ -64,7 +123,60 @@ func (c *S3Client) GetObject(ctx context.Context, bucket, key string) (io.ReadCl
 		return nil, fmt.Errorf("error getting object from S3: %w", err)
 	}
 
-	return result.Body, nil
+	return &Object{
+		ObjectInfo: s3ObjectInfo(result.ContentLength, result.ETag, result.LastModified, result.ContentType, result.Metadata),
+		Body:       result.Body,
+	}, nil
+}
+
+// HeadObject retrieves the metadata of an object from S3
+func (c *S3Client) HeadObject(ctx context.Context, bucket, key string) (*ObjectInfo, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+
+	result, err := c.client.HeadObject(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("error getting object info from S3: %w", err)
+	}
+
+	info := s3ObjectInfo(result.ContentLength, result.ETag, result.LastModified, result.ContentType, result.Metadata)
+	return &info, nil
+}
+
+// PutObject stores the data with the content type and metadata of info in S3
+func (c *S3Client) PutObject(ctx context.Context, bucket, key string, data []byte, info ObjectInfo) error {
+	input := &s3.PutObjectInput{
+		Bucket:        aws.String(bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+		ContentType:   aws.String(info.ContentType),
+		Metadata:      info.Metadata,
+	}
+
+	if _, err := c.client.PutObject(ctx, input); err != nil {
+		return fmt.Errorf("error putting object to S3: %w", err)
+	}
+	return nil
+}
+
+// s3ObjectInfo converts the optional metadata fields of an S3 response
+func s3ObjectInfo(contentLength *int64, etag *string, lastModified *time.Time, contentType *string, metadata map[string]string) ObjectInfo {
+	info := ObjectInfo{
+		ContentLength: -1,
+		ETag:          aws.ToString(etag),
+		ContentType:   aws.ToString(contentType),
+		Metadata:      metadata,
+	}
+	if contentLength != nil {
+		info.ContentLength = *contentLength
+	}
+	if lastModified != nil {
+		info.LastModified = *lastModified
+	}
+	return info
 }
 
 func (c *S3Client) ListBuckets(ctx context.Context) ([]string, error) {
@@ -81,10 +193,29 @@ func (c *S3Client) ListBuckets(ctx context.Context) ([]string, error) {
 	return buckets, nil
 }
 
+// CheckHealth checks the buckets of the sources using the client with HEAD requests. Clients without known buckets,
+// e.g. resolving them with a matcher, list the buckets instead unless they assume a role.
 func (c *S3Client) CheckHealth(ctx context.Context) error {
-	_, err := c.ListBuckets(ctx)
-	if err != nil {
-		return fmt.Errorf("error listing buckets: %w", err)
+	if len(c.buckets) == 0 {
+		if c.assumesRole {
+			return nil
+		}
+		if _, err := c.ListBuckets(ctx); err != nil {
+			return fmt.Errorf("error listing buckets: %w", err)
+		}
+		return nil
+	}
+	for _, bucket := range c.buckets {
+		if _, err := c.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)}); err != nil {
+			return fmt.Errorf("error checking bucket %s: %w", bucket, err)
+		}
 	}
 	return nil
 }
+
+// addBucket adds the bucket to the health check
+func (c *S3Client) addBucket(bucket string) {
+	if bucket != "" && !slices.Contains(c.buckets, bucket) {
+		c.buckets = append(c.buckets, bucket)
+	}
+}
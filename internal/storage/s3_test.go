@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spossner/img-sizer/internal/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3ClientCustomEndpoint(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "")
+
+	// S3 compatible stand-in with a self-signed certificate
+	var requestedPath, authorization string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedPath = r.URL.Path
+		authorization = r.Header.Get("Authorization")
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte("image data"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name           string
+		cfg            config.S3
+		opts           S3Options
+		expectedPath   string
+		expectedRegion string
+		wantErr        bool
+	}{
+		{
+			name:           "path style with skipped verification",
+			cfg:            config.S3{Endpoint: server.URL, UsePathStyle: true, InsecureSkipVerify: true},
+			expectedPath:   "/my-bucket/images/test.jpg",
+			expectedRegion: "eu-central-1",
+		},
+		{
+			name:           "source endpoint and region",
+			cfg:            config.S3{Endpoint: "https://unused.invalid", UsePathStyle: true, InsecureSkipVerify: true},
+			opts:           S3Options{Region: "us-east-1", Endpoint: server.URL},
+			expectedPath:   "/my-bucket/images/test.jpg",
+			expectedRegion: "us-east-1",
+		},
+		{
+			name:    "verification of self-signed certificate",
+			cfg:     config.S3{Endpoint: server.URL, UsePathStyle: true},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestedPath, authorization = "", ""
+			client, err := NewS3Client(context.Background(), tt.cfg, tt.opts)
+			require.NoError(t, err)
+
+			object, err := client.GetObject(context.Background(), "my-bucket", "images/test.jpg")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer object.Body.Close()
+
+			data, err := io.ReadAll(object.Body)
+			require.NoError(t, err)
+			assert.Equal(t, "image data", string(data))
+			assert.Equal(t, `"abc"`, object.ETag)
+			assert.Equal(t, tt.expectedPath, requestedPath)
+			assert.Contains(t, authorization, "/"+tt.expectedRegion+"/s3/aws4_request", "request should be signed for the region")
+		})
+	}
+}
+
+func TestS3OptionsString(t *testing.T) {
+	assert.Equal(t, "default", S3Options{}.String())
+	assert.Equal(t, "region=us-east-1,profile=partner", S3Options{Region: "us-east-1", Profile: "partner"}.String())
+}
+
+func TestS3ClientPutAndHeadObject(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+	var contentType, metadata string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			contentType = r.Header.Get("Content-Type")
+			metadata = r.Header.Get("X-Amz-Meta-Etag")
+			body, _ = io.ReadAll(r.Body)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", "10")
+		w.Header().Set("X-Amz-Meta-Etag", metadata)
+	}))
+	defer server.Close()
+
+	client, err := NewS3Client(context.Background(), config.S3{Endpoint: server.URL, UsePathStyle: true}, S3Options{})
+	require.NoError(t, err)
+
+	info := ObjectInfo{ContentType: "image/webp", Metadata: map[string]string{"etag": `"abc"`}}
+	require.NoError(t, client.PutObject(context.Background(), "results", "aa", []byte("image data"), info))
+	assert.Equal(t, "image/webp", contentType)
+	assert.Equal(t, `"abc"`, metadata)
+	assert.Equal(t, "image data", string(body))
+
+	head, err := client.HeadObject(context.Background(), "results", "aa")
+	require.NoError(t, err)
+	assert.Equal(t, "image/webp", head.ContentType)
+	assert.Equal(t, int64(10), head.ContentLength)
+	assert.Equal(t, `"abc"`, head.Metadata["etag"])
+}
+
+func TestS3ClientCheckHealth(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+	// Read-only access: the images bucket may be checked, but listing all buckets is denied
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method != http.MethodHead || r.URL.Path != "/images" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+	cfg := config.S3{Endpoint: server.URL, UsePathStyle: true}
+
+	tests := []struct {
+		name     string
+		opts     S3Options
+		buckets  []string
+		requests []string
+		wantErr  bool
+	}{
+		{name: "source buckets", buckets: []string{"images", "images"}, requests: []string{"HEAD /images"}},
+		{name: "inaccessible bucket", buckets: []string{"images", "other"}, requests: []string{"HEAD /images", "HEAD /other"}, wantErr: true},
+		{name: "assumed role with source bucket", opts: S3Options{AssumeRoleARN: "arn:aws:iam::123456789012:role/img-sizer-read"}, buckets: []string{"images"}, requests: []string{"HEAD /images"}},
+		{name: "assumed role without known bucket", opts: S3Options{AssumeRoleARN: "arn:aws:iam::123456789012:role/img-sizer-read"}},
+		{name: "without known bucket", requests: []string{"GET /"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = nil
+			client, err := NewS3Client(context.Background(), cfg, tt.opts)
+			require.NoError(t, err)
+			if tt.opts.AssumeRoleARN != "" {
+				// Skip the STS call of the assumed role
+				client.client = s3.New(s3.Options{
+					BaseEndpoint: aws.String(server.URL),
+					UsePathStyle: true,
+					Region:       "eu-central-1",
+					Credentials:  credentials.NewStaticCredentialsProvider("test", "test", ""),
+				})
+			}
+			for _, bucket := range tt.buckets {
+				client.addBucket(bucket)
+			}
+
+			err = client.CheckHealth(context.Background())
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.requests, requests)
+		})
+	}
+}
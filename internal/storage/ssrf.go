@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+var ErrForbiddenAddress = errors.New("address not allowed")
+
+// blockedNetworks are special purpose ranges not covered by the net.IP classification helpers
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",      // "this" network
+	"100.64.0.0/10",  // carrier-grade NAT
+	"192.0.0.0/24",   // IETF protocol assignments
+	"198.18.0.0/15",  // benchmarking
+	"::/96",          // IPv4-compatible (deprecated)
+	"64:ff9b:1::/48", // local-use IPv4/IPv6 translation, the IPv4 address may be embedded anywhere
+)
+
+// translationNetworks embed an IPv4 address at the given offset, which must be public as well
+var translationNetworks = []struct {
+	network *net.IPNet
+	offset  int
+}{
+	{network: mustParseCIDRs("64:ff9b::/96")[0], offset: 12}, // NAT64 well-known prefix
+	{network: mustParseCIDRs("2002::/16")[0], offset: 2},     // 6to4
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// isPublicIP reports whether the IP is a public unicast address, allowedNetworks override the check
+func isPublicIP(ip net.IP, allowedNetworks []*net.IPNet) bool {
+	for _, network := range allowedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	for _, translation := range translationNetworks {
+		if translation.network.Contains(ip) {
+			return isPublicIP(net.IP(ip.To16()[translation.offset:translation.offset+net.IPv4len]), allowedNetworks)
+		}
+	}
+	return true
+}
+
+// dialControl rejects connections to non-public addresses after DNS resolution, so
+// hostnames resolving to internal targets are caught on every connection including redirects
+func dialControl(allowedNetworks []*net.IPNet) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		ip := net.ParseIP(host)
+		if ip == nil || !isPublicIP(ip, allowedNetworks) {
+			return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+		}
+		return nil
+	}
+}
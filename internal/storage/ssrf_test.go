@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		name     string
+		ip       string
+		allowed  []*net.IPNet
+		expected bool
+	}{
+		{name: "public ipv4", ip: "93.184.216.34", expected: true},
+		{name: "public ipv6", ip: "2606:2800:220:1:248:1893:25c8:1946", expected: true},
+		{name: "loopback", ip: "127.0.0.1", expected: false},
+		{name: "ipv6 loopback", ip: "::1", expected: false},
+		{name: "ipv4 mapped loopback", ip: "::ffff:127.0.0.1", expected: false},
+		{name: "cloud metadata", ip: "169.254.169.254", expected: false},
+		{name: "rfc1918 10/8", ip: "10.1.2.3", expected: false},
+		{name: "rfc1918 172.16/12", ip: "172.20.0.1", expected: false},
+		{name: "rfc1918 192.168/16", ip: "192.168.1.1", expected: false},
+		{name: "unique local ipv6", ip: "fd00::1", expected: false},
+		{name: "link-local ipv6", ip: "fe80::1", expected: false},
+		{name: "unspecified", ip: "0.0.0.0", expected: false},
+		{name: "carrier-grade nat", ip: "100.64.0.1", expected: false},
+		{name: "multicast", ip: "224.0.0.1", expected: false},
+		{name: "ipv4 compatible loopback", ip: "::7f00:1", expected: false},
+		{name: "nat64 metadata", ip: "64:ff9b::a9fe:a9fe", expected: false},
+		{name: "nat64 loopback", ip: "64:ff9b::7f00:1", expected: false},
+		{name: "nat64 public", ip: "64:ff9b::5db8:d822", expected: true},
+		{name: "local-use nat64", ip: "64:ff9b:1::5db8:d822", expected: false},
+		{name: "6to4 metadata", ip: "2002:a9fe:a9fe::1", expected: false},
+		{name: "6to4 private", ip: "2002:0a01:0203::1", expected: false},
+		{name: "6to4 public", ip: "2002:5db8:d822::1", expected: true},
+		{name: "allowlisted nat64 private network", ip: "64:ff9b::a01:203", allowed: mustParseCIDRs("10.1.0.0/16"), expected: true},
+		{name: "allowlisted private network", ip: "10.1.2.3", allowed: mustParseCIDRs("10.1.0.0/16"), expected: true},
+		{name: "private network outside allowlist", ip: "10.2.2.3", allowed: mustParseCIDRs("10.1.0.0/16"), expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isPublicIP(net.ParseIP(tt.ip), tt.allowed))
+		})
+	}
+}
+
+func TestDialControl(t *testing.T) {
+	control := dialControl(nil)
+
+	assert.NoError(t, control("tcp4", "93.184.216.34:443", nil))
+	assert.ErrorIs(t, control("tcp4", "169.254.169.254:80", nil), ErrForbiddenAddress)
+	assert.ErrorIs(t, control("tcp6", "[::1]:80", nil), ErrForbiddenAddress)
+	assert.Error(t, control("tcp4", "invalid", nil))
+}
@@ -16,3 +16,16 @@ func CalculateETag(img []byte, params string) string {
 	// Return the hash as a hex string
 	return fmt.Sprintf("\"%s\"", hex.EncodeToString(hash.Sum(nil)))
 }
+
+// CalculateSourceETag generates an ETag based on the source and its ETag and the processing parameters.
+// It is known before the image is processed, so conditional requests can be answered from the source metadata.
+func CalculateSourceETag(source, sourceETag, params string) string {
+	hash := sha256.New()
+	hash.Write([]byte(source))
+	hash.Write([]byte{0})
+	hash.Write([]byte(sourceETag))
+	hash.Write([]byte{0})
+	hash.Write([]byte(params))
+
+	return fmt.Sprintf("\"%s\"", hex.EncodeToString(hash.Sum(nil)))
+}
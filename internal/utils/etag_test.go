@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -102,3 +103,25 @@ func TestCalculateETagUniqueness(t *testing.T) {
 		t.Error("ETags should be different for different params")
 	}
 }
+
+func TestCalculateSourceETag(t *testing.T) {
+	etag := CalculateSourceETag("https://example.com/a.jpg", `"abc"`, "width=100&height=200")
+
+	if etag != CalculateSourceETag("https://example.com/a.jpg", `"abc"`, "width=100&height=200") {
+		t.Error("ETags should be consistent")
+	}
+	if !strings.HasPrefix(etag, "\"") || !strings.HasSuffix(etag, "\"") {
+		t.Errorf("ETag should be quoted: %s", etag)
+	}
+
+	for name, other := range map[string]string{
+		"source":         CalculateSourceETag("https://example.com/b.jpg", `"abc"`, "width=100&height=200"),
+		"source ETag":    CalculateSourceETag("https://example.com/a.jpg", `"def"`, "width=100&height=200"),
+		"params":         CalculateSourceETag("https://example.com/a.jpg", `"abc"`, "width=200&height=100"),
+		"field boundary": CalculateSourceETag("https://example.com/a.jpg\"", `abc"`, "width=100&height=200"),
+	} {
+		if etag == other {
+			t.Errorf("ETags should be different for different %s", name)
+		}
+	}
+}
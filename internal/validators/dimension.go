@@ -25,6 +25,9 @@ func ValidateInputDimensions(cfg *config.Config, width, height int) error {
 	if width > cfg.MaxInputDimension || height > cfg.MaxInputDimension {
 		return fmt.Errorf("image dimensions too large")
 	}
+	if cfg.MaxInputPixels > 0 && int64(width)*int64(height) > cfg.MaxInputPixels {
+		return fmt.Errorf("image has too many pixels")
+	}
 	return nil
 }
 
@@ -142,6 +142,60 @@ func TestValidateInputDimensions(t *testing.T) {
 	}
 }
 
+func TestValidateInputPixels(t *testing.T) {
+	cfg := &config.Config{
+		MaxInputDimension: 60000,
+		MaxInputPixels:    25_000_000,
+	}
+
+	tests := []struct {
+		name    string
+		width   int
+		height  int
+		wantErr bool
+	}{
+		{
+			name:    "within pixel limit",
+			width:   5000,
+			height:  5000,
+			wantErr: false,
+		},
+		{
+			name:    "exceeds pixel limit",
+			width:   5000,
+			height:  5001,
+			wantErr: true,
+		},
+		{
+			name:    "long panorama within dimension but exceeding pixel limit",
+			width:   50000,
+			height:  1000,
+			wantErr: true,
+		},
+		{
+			name:    "product overflowing int32",
+			width:   60000,
+			height:  60000,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateInputDimensions(cfg, tt.width, tt.height)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateInputDimensions(%d, %d) error = %v, wantErr %v", tt.width, tt.height, err, tt.wantErr)
+			}
+		})
+	}
+
+	// Without a pixel limit only the dimension limit applies
+	cfg.MaxInputPixels = 0
+	if err := ValidateInputDimensions(cfg, 50000, 1000); err != nil {
+		t.Errorf("ValidateInputDimensions without pixel limit error = %v", err)
+	}
+}
+
 func TestValidateOutputDimensions(t *testing.T) {
 	cfg := &config.Config{
 		MaxOutputDimension: 2000,
@@ -265,3 +319,48 @@ func TestValidateCropZone(t *testing.T) {
 		})
 	}
 }
+
+// Crop zones refer to the EXIF oriented image, so a 4000x3000 sensor image stored with
+// orientation 6 (rotated 90 degrees) is validated against 3000x4000
+func TestValidateCropZoneOrientedImage(t *testing.T) {
+	const storedWidth, storedHeight = 4000, 3000
+	orientedWidth, orientedHeight := storedHeight, storedWidth
+
+	tests := []struct {
+		name    string
+		crop    image.Rectangle
+		wantErr bool
+	}{
+		{
+			name:    "crop within oriented height but exceeding stored height",
+			crop:    image.Rect(0, 3000, 1000, 4000),
+			wantErr: false,
+		},
+		{
+			name:    "crop within stored width but exceeding oriented width",
+			crop:    image.Rect(3000, 0, 4000, 1000),
+			wantErr: true,
+		},
+		{
+			name:    "full oriented image",
+			crop:    image.Rect(0, 0, 3000, 4000),
+			wantErr: false,
+		},
+		{
+			name:    "full stored image",
+			crop:    image.Rect(0, 0, 4000, 3000),
+			wantErr: true,
+		},
+	}
+
+	cfg := &config.Config{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCropZone(cfg, orientedWidth, orientedHeight, tt.crop)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCropZone(%d, %d, %v) error = %v, wantErr %v", orientedWidth, orientedHeight, tt.crop, err, tt.wantErr)
+			}
+		})
+	}
+}